@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxHotKeys the maximum number of the keys whose hits are counted.
+const maxHotKeys = 10000
+
+// CapturedRequest the request which generates the entry, the background refresh replays it,
+// only the selected headers are captured, see WithRefreshHeaders.
+type CapturedRequest struct {
+	Method string
+	Host   string
+	// URL the request uri, the path and the query.
+	URL    string
+	Header http.Header
+}
+
+// WithRefreshAhead enables the refresh-ahead for the hot keys, on a hit in window before the entry expires,
+// the entry is refreshed in the background if it has been hit minHits times at least,
+// so the hot keys never go cold. the hits are counted per entry in the process,
+// the refreshed entry starts counting from zero.
+// the background refresh runs the handler with a request made of the captured one, see CapturedRequest.
+// window zero or negative disables it.
+func WithRefreshAhead(window time.Duration, minHits int) Option {
+	return func(c *Config) {
+		c.aheadWindow = window
+		c.aheadMinHits = minHits
+	}
+}
+
+// WithRefreshHeaders custom the request headers captured in the entry for the background refresh,
+// default is Accept and Accept-Language, the credentials, such as Cookie and Authorization,
+// should not be captured as the entry is shared.
+func WithRefreshHeaders(headers ...string) Option {
+	return func(c *Config) {
+		c.refreshHeaders = headers
+	}
+}
+
+// WithRefreshWorkers custom the maximum number of the concurrent background refreshes, default is 4,
+// the refreshes beyond it are dropped.
+func WithRefreshWorkers(n int) Option {
+	return func(c *Config) {
+		if n > 0 {
+			c.refreshWorkers = n
+		}
+	}
+}
+
+// shouldRefreshAhead counts the hit of the entry, reports whether the entry is hot
+// and in the refresh-ahead window.
+func (cfg *Config) shouldRefreshAhead(key string, bc *BodyCache) bool {
+	if cfg.aheadWindow <= 0 || bc.ExpireAt.IsZero() {
+		return false
+	}
+	now := cfg.clock.Now()
+	hits := cfg.hotKeys.hit(key, bc.CreatedAt)
+	return hits >= cfg.aheadMinHits && !now.Before(bc.ExpireAt.Add(-cfg.aheadWindow))
+}
+
+// captureRequest captures req for the background refresh.
+func (cfg *Config) captureRequest(req *http.Request) *CapturedRequest {
+	captured := &CapturedRequest{
+		Method: req.Method,
+		Host:   req.Host,
+		URL:    req.RequestURI,
+		Header: make(http.Header, len(cfg.refreshHeaders)),
+	}
+	if captured.URL == "" {
+		captured.URL = req.URL.RequestURI()
+	}
+	for _, k := range cfg.refreshHeaders {
+		if v := req.Header.Values(k); len(v) > 0 {
+			captured.Header[http.CanonicalHeaderKey(k)] = append([]string(nil), v...)
+		}
+	}
+	return captured
+}
+
+// newRequest makes the request for the background refresh.
+func (r *CapturedRequest) newRequest() (*http.Request, error) {
+	req, err := http.NewRequestWithContext(context.Background(), r.Method, r.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Host = r.Host
+	req.RequestURI = r.URL
+	req.Header = r.Header.Clone()
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	return req, nil
+}
+
+// hotKeys counts the hits of the entries, the count is reset when the entry is regenerated.
+// it keeps the maxHotKeys most recently hit keys, the least recently hit key is evicted.
+type hotKeys struct {
+	mu      sync.Mutex
+	ll      *list.List
+	entries map[string]*list.Element
+}
+
+type hotKey struct {
+	key       string
+	createdAt time.Time
+	hits      int
+}
+
+// hit counts the hit of the entry, returns the hits of it.
+func (h *hotKeys) hit(key string, createdAt time.Time) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.entries == nil {
+		h.ll = list.New()
+		h.entries = make(map[string]*list.Element)
+	}
+	el, ok := h.entries[key]
+	if !ok {
+		if h.ll.Len() >= maxHotKeys {
+			back := h.ll.Back()
+			h.ll.Remove(back)
+			delete(h.entries, back.Value.(*hotKey).key)
+		}
+		el = h.ll.PushFront(&hotKey{key: key, createdAt: createdAt})
+		h.entries[key] = el
+	} else {
+		h.ll.MoveToFront(el)
+	}
+	e := el.Value.(*hotKey)
+	if !e.createdAt.Equal(createdAt) {
+		e.createdAt, e.hits = createdAt, 0
+	}
+	e.hits++
+	return e.hits
+}
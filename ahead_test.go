@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/gin-cache/cachetest"
+)
+
+func TestCacheRefreshAhead(t *testing.T) {
+	clock := cachetest.NewClock(time.Now())
+	store := cachetest.NewStore(cachetest.WithClock(clock))
+	var count atomic.Int32
+	requests := make(chan *http.Request, 4)
+	stored := make(chan struct{}, 4)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user", c.GetHeader("Cookie"))
+	})
+	r.GET("/cache/:page", Cache(store, time.Minute, func(c *gin.Context) {
+		requests <- c.Request
+		assert.Equal(t, c.Request.Header.Get("Cookie"), c.GetString("user"))
+		c.String(http.StatusOK, fmt.Sprint(count.Add(1), c.Param("page")))
+	},
+		WithClock(clock),
+		WithRefreshAhead(10*time.Second, 3),
+		WithHooks(Hooks{OnStore: func(*gin.Context, string, *BodyCache) { stored <- struct{}{} }}),
+	))
+
+	header := http.Header{"Accept": {"text/html"}, "Cookie": {"session=secret"}}
+	w := performRequestWithHeader("/cache/hot?q=1", r, header)
+	assert.Equal(t, "1hot", w.Body.String())
+	<-requests
+	<-stored
+
+	// hot, but not in the window.
+	for i := 0; i < 3; i++ {
+		clock.Advance(10 * time.Second)
+		w = performRequestWithHeader("/cache/hot?q=1", r, header)
+		assert.Equal(t, "1hot", w.Body.String())
+	}
+	assert.Equal(t, int32(1), count.Load())
+
+	// hot and in the window, refreshed with the captured request.
+	clock.Advance(25 * time.Second)
+	w = performRequestWithHeader("/cache/hot?q=1", r, header)
+	assert.Equal(t, "1hot", w.Body.String())
+	select {
+	case <-stored:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the hot entry is not refreshed")
+	}
+	req := <-requests
+	assert.Equal(t, http.MethodGet, req.Method)
+	assert.Equal(t, "/cache/hot?q=1", req.RequestURI)
+	assert.Equal(t, "1", req.URL.Query().Get("q"))
+	assert.Equal(t, "text/html", req.Header.Get("Accept"))
+	assert.Empty(t, req.Header.Get("Cookie"))
+
+	clock.Advance(time.Second)
+	w = performRequestWithHeader("/cache/hot?q=1", r, header)
+	assert.Equal(t, "2hot", w.Body.String())
+}
+
+func TestCacheRefreshAheadCold(t *testing.T) {
+	clock := cachetest.NewClock(time.Now())
+	store := cachetest.NewStore(cachetest.WithClock(clock))
+	var count atomic.Int32
+
+	r := gin.New()
+	r.GET("/cache/cold", Cache(store, time.Minute, func(c *gin.Context) {
+		c.String(http.StatusOK, fmt.Sprint(count.Add(1)))
+	}, WithClock(clock), WithRefreshAhead(10*time.Second, 3)))
+
+	performRequest("/cache/cold", r)
+	clock.Advance(55 * time.Second)
+	w := performRequest("/cache/cold", r)
+	assert.Equal(t, "1", w.Body.String())
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(1), count.Load())
+}
+
+func TestCacheRefreshWorkers(t *testing.T) {
+	clock := cachetest.NewClock(time.Now())
+	store := cachetest.NewStore(cachetest.WithClock(clock))
+	var count atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	r := gin.New()
+	r.GET("/cache/:page", Cache(store, time.Minute, func(c *gin.Context) {
+		if count.Add(1) == 3 {
+			// the refresh of the first page holds the only worker.
+			close(started)
+			<-release
+		}
+		c.String(http.StatusOK, "pong")
+	},
+		WithClock(clock),
+		WithRefreshAhead(10*time.Second, 1),
+		WithRefreshWorkers(1),
+	))
+
+	performRequest("/cache/a", r)
+	performRequest("/cache/b", r)
+	clock.Advance(55 * time.Second)
+	performRequest("/cache/a", r)
+	<-started
+	performRequest("/cache/b", r)
+	close(release)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(3), count.Load())
+}
+
+func TestHotKeys(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := new(hotKeys)
+	require.Equal(t, 1, h.hit("a", now))
+	require.Equal(t, 2, h.hit("a", now))
+	// the regenerated entry starts counting from zero.
+	require.Equal(t, 1, h.hit("a", now.Add(time.Second)))
+
+	for i := 1; i < maxHotKeys; i++ {
+		h.hit(fmt.Sprint(i), now)
+	}
+	require.Equal(t, 2, h.hit("1", now))
+	// the least recently hit key is evicted when it is full.
+	require.Equal(t, 1, h.hit("full", now))
+	require.Len(t, h.entries, maxHotKeys)
+	require.Equal(t, 1, h.hit("a", now.Add(time.Second)))
+	require.Equal(t, 3, h.hit("1", now))
+}
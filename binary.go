@@ -0,0 +1,328 @@
+package cache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// CodecBinary the identifier of BinaryEncoding.
+const CodecBinary uint8 = 3
+
+// BinaryEncoding binary field layout:
+//
+//	field: tag(1 byte) | length(uvarint) | payload
+//	status: varint
+//	header: key length(uvarint) | key | value count(uvarint) | { value length(uvarint) | value }
+//	body:   raw bytes
+//	created at: varint, unix nano
+//	expire at: varint, unix nano
+//	compute time: varint, nanoseconds
+//	request: the fields of the captured request, method, host, url, and header as above
+//
+// one header field per header key, unknown fields are skipped.
+const (
+	binaryTagStatus    = 1
+	binaryTagHeader    = 2
+	binaryTagBody      = 3
+	binaryTagCreatedAt = 4
+	binaryTagExpireAt  = 5
+	binaryTagCompute   = 6
+	binaryTagRequest   = 7
+)
+
+// the fields of the captured request.
+const (
+	binaryTagRequestMethod = 1
+	binaryTagRequestHost   = 2
+	binaryTagRequestURL    = 3
+	binaryTagRequestHeader = 4
+)
+
+// ErrBinaryUnsupported BinaryEncoding only supports BodyCache.
+var ErrBinaryUnsupported = errors.New("gincache: binary encoding only supports BodyCache")
+
+// BinaryEncoding a compact binary Encoding for BodyCache, which stores
+// the body as raw bytes, only supports BodyCache and *BodyCache.
+type BinaryEncoding struct{}
+
+var _ Codec = BinaryEncoding{}
+
+// CodecID implement Codec interface.
+func (BinaryEncoding) CodecID() uint8 { return CodecBinary }
+
+// Marshal implement Encoding interface.
+func (BinaryEncoding) Marshal(v any) ([]byte, error) {
+	var bc *BodyCache
+	switch vv := v.(type) {
+	case *BodyCache:
+		bc = vv
+	case BodyCache:
+		bc = &vv
+	default:
+		return nil, ErrBinaryUnsupported
+	}
+
+	size := binaryFieldSize(varintSize(int64(bc.Status)))
+	for k, vs := range bc.Header {
+		size += binaryFieldSize(binaryHeaderSize(k, vs))
+	}
+	if bc.Data != nil {
+		size += binaryFieldSize(len(bc.Data))
+	}
+	if !bc.CreatedAt.IsZero() {
+		size += binaryFieldSize(varintSize(bc.CreatedAt.UnixNano()))
+	}
+	if !bc.ExpireAt.IsZero() {
+		size += binaryFieldSize(varintSize(bc.ExpireAt.UnixNano()))
+	}
+	if bc.ComputeTime != 0 {
+		size += binaryFieldSize(varintSize(int64(bc.ComputeTime)))
+	}
+	if bc.Request != nil {
+		size += binaryFieldSize(binaryRequestSize(bc.Request))
+	}
+
+	b := make([]byte, 0, size)
+	b = appendBinaryField(b, binaryTagStatus, varintSize(int64(bc.Status)))
+	b = binary.AppendVarint(b, int64(bc.Status))
+	for k, vs := range bc.Header {
+		b = appendBinaryHeader(b, binaryTagHeader, k, vs)
+	}
+	if bc.Data != nil {
+		b = appendBinaryField(b, binaryTagBody, len(bc.Data))
+		b = append(b, bc.Data...)
+	}
+	if !bc.CreatedAt.IsZero() {
+		b = appendBinaryVarintField(b, binaryTagCreatedAt, bc.CreatedAt.UnixNano())
+	}
+	if !bc.ExpireAt.IsZero() {
+		b = appendBinaryVarintField(b, binaryTagExpireAt, bc.ExpireAt.UnixNano())
+	}
+	if bc.ComputeTime != 0 {
+		b = appendBinaryVarintField(b, binaryTagCompute, int64(bc.ComputeTime))
+	}
+	if bc.Request != nil {
+		b = appendBinaryField(b, binaryTagRequest, binaryRequestSize(bc.Request))
+		b = appendBinaryString(b, binaryTagRequestMethod, bc.Request.Method)
+		b = appendBinaryString(b, binaryTagRequestHost, bc.Request.Host)
+		b = appendBinaryString(b, binaryTagRequestURL, bc.Request.URL)
+		for k, vs := range bc.Request.Header {
+			b = appendBinaryHeader(b, binaryTagRequestHeader, k, vs)
+		}
+	}
+	return b, nil
+}
+
+// Unmarshal implement Encoding interface, v must be *BodyCache.
+func (BinaryEncoding) Unmarshal(data []byte, v any) error {
+	bc, ok := v.(*BodyCache)
+	if !ok {
+		return ErrBinaryUnsupported
+	}
+
+	bc.Status = 0
+	bc.Header = nil
+	bc.Data = nil
+	bc.CreatedAt = time.Time{}
+	bc.ExpireAt = time.Time{}
+	bc.ComputeTime = 0
+	bc.Request = nil
+	for len(data) > 0 {
+		tag, payload, rest, err := nextBinaryField(data)
+		if err != nil {
+			return err
+		}
+		data = rest
+
+		switch tag {
+		case binaryTagStatus:
+			status, n := binary.Varint(payload)
+			if n <= 0 || n != len(payload) {
+				return fmt.Errorf("gincache: invalid binary status field")
+			}
+			bc.Status = int(status)
+		case binaryTagHeader:
+			if bc.Header == nil {
+				bc.Header = make(http.Header)
+			}
+			if err := decodeBinaryHeader(payload, bc.Header); err != nil {
+				return err
+			}
+		case binaryTagBody:
+			bc.Data = make([]byte, len(payload))
+			copy(bc.Data, payload)
+		case binaryTagCreatedAt:
+			nsec, err := decodeBinaryVarint(payload, "created at")
+			if err != nil {
+				return err
+			}
+			bc.CreatedAt = time.Unix(0, nsec)
+		case binaryTagExpireAt:
+			nsec, err := decodeBinaryVarint(payload, "expire at")
+			if err != nil {
+				return err
+			}
+			bc.ExpireAt = time.Unix(0, nsec)
+		case binaryTagCompute:
+			nsec, err := decodeBinaryVarint(payload, "compute time")
+			if err != nil {
+				return err
+			}
+			bc.ComputeTime = time.Duration(nsec)
+		case binaryTagRequest:
+			r, err := decodeBinaryRequest(payload)
+			if err != nil {
+				return err
+			}
+			bc.Request = r
+		}
+	}
+	return nil
+}
+
+// nextBinaryField splits the first field of data.
+func nextBinaryField(data []byte) (tag byte, payload, rest []byte, err error) {
+	length, n := binary.Uvarint(data[1:])
+	if n <= 0 || length > uint64(len(data)-1-n) {
+		return 0, nil, nil, io.ErrUnexpectedEOF
+	}
+	return data[0], data[1+n : 1+n+int(length)], data[1+n+int(length):], nil
+}
+
+func decodeBinaryRequest(data []byte) (*CapturedRequest, error) {
+	r := &CapturedRequest{Header: make(http.Header)}
+	for len(data) > 0 {
+		tag, payload, rest, err := nextBinaryField(data)
+		if err != nil {
+			return nil, err
+		}
+		data = rest
+
+		switch tag {
+		case binaryTagRequestMethod:
+			r.Method = string(payload)
+		case binaryTagRequestHost:
+			r.Host = string(payload)
+		case binaryTagRequestURL:
+			r.URL = string(payload)
+		case binaryTagRequestHeader:
+			if err := decodeBinaryHeader(payload, r.Header); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return r, nil
+}
+
+func decodeBinaryVarint(payload []byte, name string) (int64, error) {
+	x, n := binary.Varint(payload)
+	if n <= 0 || n != len(payload) {
+		return 0, fmt.Errorf("gincache: invalid binary %s field", name)
+	}
+	return x, nil
+}
+
+func decodeBinaryHeader(payload []byte, h http.Header) error {
+	next := func() ([]byte, error) {
+		length, n := binary.Uvarint(payload)
+		if n <= 0 || length > uint64(len(payload)-n) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		b := payload[n : n+int(length)]
+		payload = payload[n+int(length):]
+		return b, nil
+	}
+
+	key, err := next()
+	if err != nil {
+		return err
+	}
+	count, n := binary.Uvarint(payload)
+	// every value takes one byte at least.
+	if n <= 0 || count > uint64(len(payload)-n) {
+		return io.ErrUnexpectedEOF
+	}
+	payload = payload[n:]
+
+	values := make([]string, 0, count)
+	for i := uint64(0); i < count; i++ {
+		v, err := next()
+		if err != nil {
+			return err
+		}
+		values = append(values, string(v))
+	}
+	if len(payload) != 0 {
+		return fmt.Errorf("gincache: invalid binary header field")
+	}
+	h[string(key)] = values
+	return nil
+}
+
+func appendBinaryField(b []byte, tag byte, length int) []byte {
+	b = append(b, tag)
+	return binary.AppendUvarint(b, uint64(length))
+}
+
+func appendBinaryString(b []byte, tag byte, s string) []byte {
+	b = appendBinaryField(b, tag, len(s))
+	return append(b, s...)
+}
+
+func appendBinaryHeader(b []byte, tag byte, k string, vs []string) []byte {
+	b = appendBinaryField(b, tag, binaryHeaderSize(k, vs))
+	b = binary.AppendUvarint(b, uint64(len(k)))
+	b = append(b, k...)
+	b = binary.AppendUvarint(b, uint64(len(vs)))
+	for _, v := range vs {
+		b = binary.AppendUvarint(b, uint64(len(v)))
+		b = append(b, v...)
+	}
+	return b
+}
+
+func appendBinaryVarintField(b []byte, tag byte, x int64) []byte {
+	b = appendBinaryField(b, tag, varintSize(x))
+	return binary.AppendVarint(b, x)
+}
+
+func binaryFieldSize(length int) int {
+	return 1 + uvarintSize(uint64(length)) + length
+}
+
+func binaryHeaderSize(k string, vs []string) int {
+	size := uvarintSize(uint64(len(k))) + len(k) + uvarintSize(uint64(len(vs)))
+	for _, v := range vs {
+		size += uvarintSize(uint64(len(v))) + len(v)
+	}
+	return size
+}
+
+func binaryRequestSize(r *CapturedRequest) int {
+	size := binaryFieldSize(len(r.Method)) + binaryFieldSize(len(r.Host)) + binaryFieldSize(len(r.URL))
+	for k, vs := range r.Header {
+		size += binaryFieldSize(binaryHeaderSize(k, vs))
+	}
+	return size
+}
+
+func uvarintSize(x uint64) int {
+	n := 1
+	for x >= 0x80 {
+		x >>= 7
+		n++
+	}
+	return n
+}
+
+func varintSize(x int64) int {
+	ux := uint64(x) << 1
+	if x < 0 {
+		ux = ^ux
+	}
+	return uvarintSize(ux)
+}
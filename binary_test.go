@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBinaryEncoding(t *testing.T) {
+	want := BodyCache{
+		Status:   2,
+		Header:   nil,
+		Data:     []byte{1, 20, 3, 90},
+		encoding: nil,
+	}
+
+	encode := BinaryEncoding{}
+
+	data, err := encode.Marshal(want)
+	require.NoError(t, err)
+
+	got := BodyCache{}
+	err = encode.Unmarshal(data, &got)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	want = BodyCache{
+		Status: http.StatusOK,
+		Header: http.Header{
+			"Content-Type": {"text/html; charset=utf-8"},
+			"Vary":         {"Accept", "Accept-Encoding"},
+			"X-Empty":      {""},
+		},
+		Data: []byte{},
+	}
+	data, err = encode.Marshal(&want)
+	require.NoError(t, err)
+	err = encode.Unmarshal(data, &got)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	// the creation time is kept in nanoseconds, a zero one is not written.
+	want.CreatedAt = time.Unix(0, time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC).UnixNano())
+	withCreatedAt, err := encode.Marshal(&want)
+	require.NoError(t, err)
+	require.Greater(t, len(withCreatedAt), len(data))
+	got = BodyCache{}
+	err = encode.Unmarshal(withCreatedAt, &got)
+	require.NoError(t, err)
+	require.True(t, want.CreatedAt.Equal(got.CreatedAt))
+	err = encode.Unmarshal(data, &got)
+	require.NoError(t, err)
+	require.True(t, got.CreatedAt.IsZero())
+
+	// so are the expiration and the compute time.
+	want.ExpireAt = want.CreatedAt.Add(time.Minute)
+	want.ComputeTime = 1500 * time.Millisecond
+	withExpireAt, err := encode.Marshal(&want)
+	require.NoError(t, err)
+	err = encode.Unmarshal(withExpireAt, &got)
+	require.NoError(t, err)
+	require.True(t, want.ExpireAt.Equal(got.ExpireAt))
+	require.Equal(t, want.ComputeTime, got.ComputeTime)
+	err = encode.Unmarshal(data, &got)
+	require.NoError(t, err)
+	require.True(t, got.ExpireAt.IsZero())
+	require.Zero(t, got.ComputeTime)
+	want.CreatedAt, want.ExpireAt, want.ComputeTime = time.Time{}, time.Time{}, 0
+
+	// so is the captured request.
+	want.Request = &CapturedRequest{
+		Method: http.MethodGet,
+		Host:   "example.com",
+		URL:    "/cache?q=1",
+		Header: http.Header{"Accept": {"text/html", "*/*"}},
+	}
+	withRequest, err := encode.Marshal(&want)
+	require.NoError(t, err)
+	err = encode.Unmarshal(withRequest, &got)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+	err = encode.Unmarshal(withRequest[:len(withRequest)-1], &got)
+	require.Error(t, err)
+	err = encode.Unmarshal(data, &got)
+	require.NoError(t, err)
+	require.Nil(t, got.Request)
+	want.Request = nil
+
+	_, err = encode.Marshal("foo")
+	require.ErrorIs(t, err, ErrBinaryUnsupported)
+	err = encode.Unmarshal(data, new(string))
+	require.ErrorIs(t, err, ErrBinaryUnsupported)
+	err = encode.Unmarshal(data[:len(data)-1], &got)
+	require.Error(t, err)
+}
+
+func TestBinaryEncodingAllocs(t *testing.T) {
+	bc := &BodyCache{
+		Status: http.StatusOK,
+		Header: http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+		Data:   bytes.Repeat([]byte("a"), 4096),
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _ = BinaryEncoding{}.Marshal(bc)
+	})
+	assert.Equal(t, float64(1), allocs)
+}
+
+func TestCacheBinaryEncoding(t *testing.T) {
+	r := gin.New()
+	r.GET("/cache/binary", Cache(newBinaryStore(), time.Second*3, func(c *gin.Context) {
+		c.Header("X-Value", "foo")
+		c.String(http.StatusOK, "pong")
+	}, WithEncoding(NewEnvelopeEncoding(BinaryEncoding{}))))
+
+	w1 := performRequest("/cache/binary", r)
+	w2 := performRequest("/cache/binary", r)
+
+	assert.Equal(t, http.StatusOK, w2.Code)
+	assert.Equal(t, w1.Body.String(), w2.Body.String())
+	assert.Equal(t, "foo", w2.Header().Get("X-Value"))
+}
+
+func FuzzBinaryEncoding(f *testing.F) {
+	for _, bc := range []*BodyCache{
+		{Status: http.StatusOK},
+		{Status: -1, Data: []byte{}},
+		{Status: http.StatusOK, Header: http.Header{"A": {"b", ""}}, Data: []byte("hello")},
+	} {
+		data, err := BinaryEncoding{}.Marshal(bc)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		got := BodyCache{}
+		if err := (BinaryEncoding{}).Unmarshal(data, &got); err != nil {
+			return
+		}
+		// the decoded entry must round trip.
+		data2, err := BinaryEncoding{}.Marshal(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got2 := BodyCache{}
+		if err = (BinaryEncoding{}).Unmarshal(data2, &got2); err != nil {
+			t.Fatal(err)
+		}
+		if !assert.ObjectsAreEqual(got, got2) {
+			t.Fatalf("round trip mismatch: %v != %v", got, got2)
+		}
+	})
+}
+
+func benchmarkBodyCache() *BodyCache {
+	return &BodyCache{
+		Status: http.StatusOK,
+		Header: http.Header{
+			"Content-Type":  {"text/html; charset=utf-8"},
+			"Cache-Control": {"public, max-age=60"},
+		},
+		Data: []byte(strings.Repeat("<div class=\"item\">hello world</div>\n", 512)),
+	}
+}
+
+func benchmarkEncodings() []struct {
+	name   string
+	encode Encoding
+} {
+	return []struct {
+		name   string
+		encode Encoding
+	}{
+		{"JSON", JSONEncoding{}},
+		{"JSONGzip", JSONGzipEncoding{}},
+		{"Binary", BinaryEncoding{}},
+	}
+}
+
+func BenchmarkEncodingMarshal(b *testing.B) {
+	bc := benchmarkBodyCache()
+	for _, tt := range benchmarkEncodings() {
+		b.Run(tt.name, func(b *testing.B) {
+			data, err := tt.encode.Marshal(bc)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, _ = tt.encode.Marshal(bc)
+			}
+			b.ReportMetric(float64(len(data)), "bytes/entry")
+		})
+	}
+}
+
+func BenchmarkEncodingUnmarshal(b *testing.B) {
+	bc := benchmarkBodyCache()
+	for _, tt := range benchmarkEncodings() {
+		b.Run(tt.name, func(b *testing.B) {
+			data, err := tt.encode.Marshal(bc)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				got := BodyCache{}
+				_ = tt.encode.Unmarshal(data, &got)
+			}
+			b.ReportMetric(float64(len(data)), "bytes/entry")
+		})
+	}
+}
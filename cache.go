@@ -3,11 +3,16 @@ package cache
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/sha1"
 	"encoding"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"sync"
 	"time"
 
@@ -20,6 +25,9 @@ import (
 // PageCachePrefix default page cache key prefix
 var PageCachePrefix = "gincache.page.cache:"
 
+// ErrDecode the cached entry can not be decoded, which is corrupt or written by another Encoding.
+var ErrDecode = errors.New("gincache: decode body cache failed")
+
 // Logger logger interface
 type Logger interface {
 	Errorf(format string, args ...any)
@@ -55,6 +63,54 @@ type Config struct {
 	logger Logger
 	// encoding default: JSONEncoding
 	encode Encoding
+	// hooks lifecycle event hooks
+	hooks hookSet
+	// tracer default: nil, trace nothing
+	tracer Tracer
+	// errorPolicy store error policy, default: ErrorPolicyMiss
+	errorPolicy ErrorPolicy
+	// errorLogInterval minimum interval between two store error logs
+	errorLogInterval time.Duration
+	// errorLogger rate limited logger for store errors
+	errorLogger Logger
+	// compression content coding to store the response body, default: CompressNone
+	compression Compression
+	// compressMinSize the minimum body size to compress
+	compressMinSize int
+	// headerPolicy which response headers are stored
+	headerPolicy headerPolicy
+	// headerMerge how to replay the cached headers, default: HeaderMergeKeepExisting
+	headerMerge HeaderMerge
+	// clock time source, default: persist.SystemClock
+	clock persist.Clock
+	// lockTTL the time to live of the distributed lock, zero disables the lock
+	lockTTL time.Duration
+	// lockWait how long to wait the lock holder to store the response
+	lockWait time.Duration
+	// lockPoll the interval to poll the store while waiting the lock, default: 50ms
+	lockPoll time.Duration
+	// earlyBeta the beta of the probabilistic early expiration, zero disables it
+	earlyBeta float64
+	// random returns a random number in (0, 1] for the probabilistic early expiration
+	random func() float64
+	// refreshing the keys being refreshed in the background
+	refreshing *sync.Map
+	// refreshWorkers the maximum number of the concurrent background refreshes, default: 4
+	refreshWorkers int
+	// refreshSem the semaphore of the background refresh workers
+	refreshSem chan struct{}
+	// refreshHeaders the request headers captured for the background refresh
+	refreshHeaders []string
+	// aheadWindow refresh the hot entries in the window before they expire, zero disables it
+	aheadWindow time.Duration
+	// aheadMinHits the minimum hits of the hot entries
+	aheadMinHits int
+	// hotKeys the hits of the entries
+	hotKeys *hotKeys
+	// followerTimeout how long the followers of the single flight wait the leader, zero waits until it finishes
+	followerTimeout time.Duration
+	// followerPolicy how to handle the followers waited too long, default: FollowerPolicyBypass
+	followerPolicy FollowerPolicy
 }
 
 // Option custom option
@@ -127,50 +183,219 @@ func Cache(store persist.Store, expire time.Duration, handle gin.HandlerFunc, op
 		pool:        NewPool(),
 		logger:      NewDiscard(),
 		encode:      JSONEncoding{},
+
+		errorPolicy:      ErrorPolicyMiss,
+		errorLogInterval: 10 * time.Second,
+		headerMerge:      HeaderMergeKeepExisting,
+		clock:            persist.SystemClock{},
+		lockPoll:         50 * time.Millisecond,
+		random:           randomFloat,
+		refreshing:       new(sync.Map),
+		refreshWorkers:   4,
+		refreshHeaders:   []string{"Accept", "Accept-Language"},
+		hotKeys:          new(hotKeys),
 	}
 	for _, opt := range opts {
 		opt(&cfg)
 	}
+	cfg.refreshSem = make(chan struct{}, cfg.refreshWorkers)
+	cfg.errorLogger = newRateLimitLogger(cfg.logger, cfg.errorLogInterval)
+	if _, ok := store.(persist.Locker); cfg.lockTTL > 0 && !ok {
+		cfg.logger.Errorf("lock is ignored, the store %T does not implement persist.Locker", store)
+	}
 
 	return func(c *gin.Context) {
+		reqCtx := c.Request.Context()
+
+		_, endSpan := cfg.startSpan(reqCtx, SpanGenerateKey)
 		key, needCache := cfg.generateKey(c)
 		if !needCache {
+			endSpan(SpanInfo{})
 			handle(c)
 			return
 		}
+		endSpan(SpanInfo{Key: key})
 
 		// read cache first
 		bodyCache := cfg.pool.Get()
 		defer cfg.pool.Put(bodyCache)
-		bodyCache.encoding = cfg.encode
 
-		if err := cfg.store.Get(key, bodyCache); err != nil {
-			// BodyWriter in order to dup the response
-			bodyWriter := &BodyWriter{ResponseWriter: c.Writer}
-			c.Writer = bodyWriter
-
-			inFlight := false
-			// use single flight to avoid Hotspot Invalid
-			bc, _, shared := cfg.group.Do(key, func() (any, error) {
+		ctx, endSpan := cfg.startSpan(reqCtx, SpanStoreGet)
+		bodyCache.encoding = cfg.encoding(ctx, key)
+		err := cfg.store.Get(key, bodyCache)
+		corrupt := false
+		if err == nil {
+			endSpan(SpanInfo{Key: key, Hit: true, Size: len(bodyCache.Data)})
+			cfg.hooks.hit(c, key, bodyCache)
+			if cfg.shouldRefreshEarly(bodyCache) || cfg.shouldRefreshAhead(key, bodyCache) {
+				cfg.refresh(c, key, handle, bodyCache.Request)
+			}
+			cfg.responseWithBodyCache(c, bodyCache)
+			return
+		}
+		switch {
+		case errors.Is(err, persist.ErrCacheMiss):
+			endSpan(SpanInfo{Key: key})
+		case errors.Is(err, ErrDecode):
+			// the entry is corrupt, evict it in the single flight and regenerate.
+			endSpan(SpanInfo{Key: key, Err: err})
+			cfg.errorLogger.Errorf("decode cache key error: %s, cache key: %s", err, key)
+			cfg.hooks.error(c, key, err)
+			corrupt = true
+		default:
+			endSpan(SpanInfo{Key: key, Err: err})
+			cfg.errorLogger.Errorf("get cache key error: %s, cache key: %s, policy: %s", err, key, cfg.errorPolicy)
+			cfg.hooks.error(c, key, err)
+			switch cfg.errorPolicy {
+			case ErrorPolicyBypass:
 				handle(c)
-				inFlight = true
-				bc := getBodyCacheFromBodyWriter(bodyWriter, cfg.encode)
-				if !c.IsAborted() && bodyWriter.Status() < 300 && bodyWriter.Status() >= 200 {
-					if err = cfg.store.Set(key, bc, cfg.expire+cfg.rand()); err != nil {
-						cfg.logger.Errorf("set cache key error: %s, cache key: %s", err, key)
-					}
+				return
+			case ErrorPolicyFail:
+				c.AbortWithStatus(http.StatusServiceUnavailable)
+				return
+			}
+		}
+		cfg.hooks.miss(c, key)
+
+		// always fetch the full representation, never store partial content.
+		c.Request.Header.Del("Range")
+		c.Request.Header.Del("If-Range")
+
+		// BodyWriter in order to dup the response
+		bodyWriter := &BodyWriter{ResponseWriter: c.Writer}
+		c.Writer = bodyWriter
+
+		inFlight := false
+		leader := false
+		// use single flight to avoid Hotspot Invalid
+		bc, err := cfg.do(key, func() (any, error) {
+			leader = true
+			if corrupt {
+				if stored := cfg.evictCorrupt(c, reqCtx, key); stored != nil {
+					// another request has regenerated the entry since.
+					return stored, nil
+				}
+			}
+			release, stored := cfg.acquireLock(c, reqCtx, key)
+			if stored != nil {
+				// another instance has stored the response while waiting the lock.
+				return stored, nil
+			}
+			if release != nil {
+				defer release()
+			}
+
+			bc := cfg.runHandler(c, reqCtx, key, handle, bodyWriter)
+			inFlight = true
+			if !cfg.headerPolicy.sanitize(bc.Header) {
+				// must not be stored or shared.
+				return nil, nil
+			}
+			if !c.IsAborted() && cacheableStatus(bodyWriter.Status()) {
+				cfg.storeBodyCache(c, reqCtx, key, bc)
+			}
+			return bc, nil
+		})
+		if err != nil {
+			var panicErr *PanicError
+			if errors.As(err, &panicErr) {
+				if panicErr.Value != http.ErrAbortHandler {
+					panic(panicErr)
 				}
-				return bc, nil
-			})
-			if !inFlight && shared {
-				responseWithBodyCache(c, bc.(*BodyCache))
+				if leader {
+					// keep aborting the response silently.
+					panic(http.ErrAbortHandler)
+				}
+				// the client of the leader has gone, which says nothing of this request,
+				// the follower is handled as it waits the leader too long.
+			}
+			// the follower waits the leader too long.
+			if cfg.followerPolicy == FollowerPolicyFail {
+				c.AbortWithStatus(http.StatusGatewayTimeout)
+				return
 			}
-		} else {
-			responseWithBodyCache(c, bodyCache)
+			handle(c)
+			return
+		}
+		// the response is generated by another request of the single flight, or stored by the lock holder.
+		if !inFlight {
+			if bc == nil {
+				handle(c)
+				return
+			}
+			cfg.responseWithBodyCache(c, bc.(*BodyCache))
 		}
 	}
 }
 
+// evictCorrupt deletes the corrupt entry of key, it runs in the single flight and reads the entry again,
+// so the entry regenerated by another request since is returned rather than deleted.
+func (cfg *Config) evictCorrupt(c *gin.Context, ctx context.Context, key string) *BodyCache {
+	// the response is shared with the followers of the single flight, so it is not pooled.
+	bc := &BodyCache{encoding: cfg.encoding(ctx, key)}
+	err := cfg.store.Get(key, bc)
+	if err == nil {
+		return bc
+	}
+	if !errors.Is(err, ErrDecode) {
+		return nil
+	}
+	if err = cfg.store.Delete(key); err != nil {
+		cfg.errorLogger.Errorf("delete cache key error: %s, cache key: %s", err, key)
+		cfg.hooks.error(c, key, err)
+	} else {
+		cfg.hooks.evict(c, key)
+	}
+	return nil
+}
+
+// runHandler runs the handler, returns the response captured by bodyWriter.
+func (cfg *Config) runHandler(c *gin.Context, reqCtx context.Context, key string, handle gin.HandlerFunc,
+	bodyWriter *BodyWriter) *BodyCache {
+	start := cfg.clock.Now()
+	ctx, endSpan := cfg.startSpan(reqCtx, SpanHandler)
+	if cfg.tracer != nil {
+		c.Request = c.Request.WithContext(ctx)
+		handle(c)
+		c.Request = c.Request.WithContext(reqCtx)
+	} else {
+		handle(c)
+	}
+	endSpan(SpanInfo{Key: key, Size: bodyWriter.dupBody.Len()})
+
+	bc := getBodyCacheFromBodyWriter(bodyWriter, cfg.encode)
+	bc.CreatedAt = cfg.clock.Now()
+	bc.ComputeTime = bc.CreatedAt.Sub(start)
+	if cfg.aheadWindow > 0 {
+		bc.Request = cfg.captureRequest(c.Request)
+	}
+	return bc
+}
+
+// cacheableStatus only the successful full responses are stored.
+func cacheableStatus(status int) bool {
+	return status >= 200 && status < 300 && status != http.StatusPartialContent
+}
+
+// storeBodyCache writes the response to the store.
+func (cfg *Config) storeBodyCache(c *gin.Context, reqCtx context.Context, key string, bc *BodyCache) {
+	expire := cfg.expire + cfg.rand()
+	if expire > 0 {
+		bc.ExpireAt = bc.CreatedAt.Add(expire)
+	}
+	ctx, endSpan := cfg.startSpan(reqCtx, SpanStoreSet)
+	bc.encoding = cfg.encoding(ctx, key)
+	cfg.compress(bc)
+	err := cfg.store.Set(key, bc, expire)
+	endSpan(SpanInfo{Key: key, Size: len(bc.Data), Err: err})
+	if err != nil {
+		cfg.errorLogger.Errorf("set cache key error: %s, cache key: %s", err, key)
+		cfg.hooks.error(c, key, err)
+	} else {
+		cfg.hooks.store(c, key, bc)
+	}
+}
+
 // CacheWithRequestURI a shortcut function for caching response with uri
 func CacheWithRequestURI(store persist.Store, expire time.Duration, handle gin.HandlerFunc, // nolint: golint,revive
 	opts ...Option) gin.HandlerFunc {
@@ -224,42 +449,96 @@ func (w *BodyWriter) WriteString(s string) (int, error) {
 
 // BodyCache body cache store
 type BodyCache struct {
-	Status   int
-	Header   http.Header
-	Data     []byte
+	Status int
+	Header http.Header
+	Data   []byte
+	// CreatedAt the time the response is generated, which is zero for the entries stored
+	// by the older versions.
+	CreatedAt time.Time
+	// ExpireAt the time the entry expires, which is zero if it never expires.
+	ExpireAt time.Time
+	// ComputeTime how long the handler took to generate the response.
+	ComputeTime time.Duration
+	// Request the request which generates the response, which is captured for the refresh-ahead only.
+	Request  *CapturedRequest
 	encoding Encoding
 }
 
 var _ encoding.BinaryMarshaler = (*BodyCache)(nil)
 var _ encoding.BinaryUnmarshaler = (*BodyCache)(nil)
+var _ persist.Sizer = (*BodyCache)(nil)
+
+// Size implement persist.Sizer interface, the byte size of the body and headers.
+func (b *BodyCache) Size() int {
+	size := len(b.Data)
+	for k, v := range b.Header {
+		size += len(k)
+		for _, vv := range v {
+			size += len(vv)
+		}
+	}
+	return size
+}
 
 func (b *BodyCache) MarshalBinary() ([]byte, error) {
 	return b.encoding.Marshal(b)
 }
 
 func (b *BodyCache) UnmarshalBinary(data []byte) error {
-	return b.encoding.Unmarshal(data, b)
+	if err := b.encoding.Unmarshal(data, b); err != nil {
+		return fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+	return nil
 }
 
 func getBodyCacheFromBodyWriter(writer *BodyWriter, encode Encoding) *BodyCache {
 	return &BodyCache{
-		writer.Status(),
-		writer.Header().Clone(),
-		writer.dupBody.Bytes(),
-		encode,
+		Status:   writer.Status(),
+		Header:   writer.Header().Clone(),
+		Data:     writer.dupBody.Bytes(),
+		encoding: encode,
 	}
 }
 
-func responseWithBodyCache(c *gin.Context, bodyCache *BodyCache) {
+func (cfg *Config) responseWithBodyCache(c *gin.Context, bodyCache *BodyCache) {
+	if cfg.serveRange(c, bodyCache) {
+		return
+	}
+
+	reader, decompress := cfg.decompressReader(c, bodyCache)
+
+	// replay the headers before the status is committed.
+	cfg.replayHeader(c, bodyCache, decompress)
+	if decompress {
+		c.Writer.Header().Del("Content-Length")
+	} else {
+		c.Writer.Header().Set("Content-Length", strconv.Itoa(len(bodyCache.Data)))
+	}
 	c.Writer.WriteHeader(bodyCache.Status)
-	for k, v := range bodyCache.Header {
-		for _, vv := range v {
-			c.Writer.Header().Add(k, vv)
+
+	if decompress {
+		defer reader.Close()
+		if _, err := io.Copy(c.Writer, reader); err != nil {
+			cfg.logger.Errorf("decompress cache body error: %s", err)
 		}
+		return
 	}
 	c.Writer.Write(bodyCache.Data) // nolint: errcheck
 }
 
+// replayHeader replay the cached headers except Content-Length,
+// and Content-Encoding if the body is decompressed.
+func (cfg *Config) replayHeader(c *gin.Context, bodyCache *BodyCache, decompress bool) {
+	header := c.Writer.Header()
+	for k, v := range bodyCache.Header {
+		if k == "Content-Length" || (decompress && k == "Content-Encoding") {
+			continue
+		}
+		cfg.headerMerge.merge(header, k, v)
+	}
+	cfg.setAge(c, bodyCache)
+}
+
 type cachePool struct {
 	pool *sync.Pool
 }
@@ -282,6 +561,10 @@ func (sf *cachePool) Get() *BodyCache {
 func (sf *cachePool) Put(c *BodyCache) {
 	c.Data = c.Data[:0]
 	c.Header = make(http.Header)
+	c.CreatedAt = time.Time{}
+	c.ExpireAt = time.Time{}
+	c.ComputeTime = 0
+	c.Request = nil
 	c.encoding = nil
 	sf.pool.Put(c)
 }
@@ -323,8 +606,14 @@ func (JSONEncoding) Unmarshal(data []byte, v any) error {
 	return json.Unmarshal(data, v)
 }
 
+// CodecID implement Codec interface.
+func (JSONEncoding) CodecID() uint8 { return CodecJSON }
+
 type JSONGzipEncoding struct{}
 
+// CodecID implement Codec interface.
+func (JSONGzipEncoding) CodecID() uint8 { return CodecJSONGzip }
+
 func (JSONGzipEncoding) Marshal(v any) ([]byte, error) {
 	buf := &bytes.Buffer{}
 	writer, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
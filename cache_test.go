@@ -2,12 +2,14 @@ package cache
 
 import (
 	"bytes"
+	"encoding"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -18,6 +20,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sync/singleflight"
 
+	"github.com/things-go/gin-cache/cachetest"
 	"github.com/things-go/gin-cache/persist"
 	"github.com/things-go/gin-cache/persist/memory"
 	redisStore "github.com/things-go/gin-cache/persist/redis"
@@ -102,15 +105,16 @@ func TestCacheNoNeedCache(t *testing.T) {
 }
 
 func TestCacheExpire(t *testing.T) {
-	store := newStore(time.Second * 60)
+	clock := cachetest.NewClock(time.Now())
+	store := memory.NewStore(cache.New(time.Second*60, time.Minute*10), memory.WithClock(clock))
 
 	r := gin.New()
 	r.GET("/cache/ping", Cache(store, time.Second, func(c *gin.Context) {
 		c.String(http.StatusOK, "pong "+fmt.Sprint(time.Now().UnixNano()))
-	}))
+	}, WithClock(clock)))
 
 	w1 := performRequest("/cache/ping", r)
-	time.Sleep(time.Second * 3)
+	clock.Advance(time.Second * 3)
 	w2 := performRequest("/cache/ping", r)
 
 	assert.Equal(t, http.StatusOK, w1.Code)
@@ -118,6 +122,24 @@ func TestCacheExpire(t *testing.T) {
 	assert.NotEqual(t, w1.Body.String(), w2.Body.String())
 }
 
+func TestCacheAge(t *testing.T) {
+	clock := cachetest.NewClock(time.Now())
+	store := cachetest.NewStore(cachetest.WithClock(clock))
+
+	r := gin.New()
+	r.GET("/cache/age", Cache(store, time.Minute, func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	}, WithClock(clock)))
+
+	w1 := performRequest("/cache/age", r)
+	clock.Advance(time.Second * 5)
+	w2 := performRequest("/cache/age", r)
+
+	assert.Empty(t, w1.Header().Get("Age"))
+	assert.Equal(t, "5", w2.Header().Get("Age"))
+	assert.Equal(t, w1.Body.String(), w2.Body.String())
+}
+
 func TestCacheHtmlFile(t *testing.T) {
 	store := newStore(time.Second * 60)
 
@@ -136,16 +158,17 @@ func TestCacheHtmlFile(t *testing.T) {
 }
 
 func TestCacheHtmlFileExpire(t *testing.T) {
-	store := newStore(time.Second * 60)
+	clock := cachetest.NewClock(time.Now())
+	store := memory.NewStore(cache.New(time.Second*60, time.Minute*10), memory.WithClock(clock))
 
 	r := gin.New()
 	r.LoadHTMLFiles("testdata/template.html")
 	r.GET("/cache/html", Cache(store, time.Second*1, func(c *gin.Context) {
 		c.HTML(http.StatusOK, "template.html", gin.H{"value": fmt.Sprint(time.Now().UnixNano())})
-	}))
+	}, WithClock(clock)))
 
 	w1 := performRequest("/cache/html", r)
-	time.Sleep(time.Second * 3)
+	clock.Advance(time.Second * 3)
 	w2 := performRequest("/cache/html", r)
 
 	assert.Equal(t, http.StatusOK, w1.Code)
@@ -268,6 +291,44 @@ func (c *memoryDelayStore) Set(key string, value any, expires time.Duration) err
 	return c.Store.Set(key, value, expires)
 }
 
+// binaryStore a store which keeps the values encoded like the remote stores.
+type binaryStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func newBinaryStore() *binaryStore {
+	return &binaryStore{data: make(map[string][]byte)}
+}
+
+func (s *binaryStore) Set(key string, value any, _ time.Duration) error {
+	b, err := value.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = b
+	return nil
+}
+
+func (s *binaryStore) Get(key string, value any) error {
+	s.mu.Lock()
+	b, ok := s.data[key]
+	s.mu.Unlock()
+	if !ok {
+		return persist.ErrCacheMiss
+	}
+	return value.(encoding.BinaryUnmarshaler).UnmarshalBinary(b)
+}
+
+func (s *binaryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
 func TestCacheInSingleflight(t *testing.T) {
 	store := newDelayStore(cache.New(60*time.Second, time.Minute*10))
 
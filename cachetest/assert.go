@@ -0,0 +1,96 @@
+package cachetest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Perform serves the request by h, returns the response and the store operations made by it.
+// h is usually the gin engine which uses the middleware with the store.
+func Perform(store *Store, h http.Handler, req *http.Request) (*httptest.ResponseRecorder, []Op) {
+	store.mu.Lock()
+	start := len(store.ops)
+	store.mu.Unlock()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return w, append([]Op(nil), store.ops[start:]...)
+}
+
+// AssertHit serves the request, and asserts it is served from the store,
+// the lookup hits and nothing is stored.
+func AssertHit(t testing.TB, store *Store, h http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	w, ops := Perform(store, h, req)
+	get, ok := firstOp(ops, OpGet)
+	switch {
+	case !ok:
+		t.Errorf("cachetest: %s %s: expected a cache hit, but the store is not looked up", req.Method, req.URL)
+	case !get.Hit:
+		t.Errorf("cachetest: %s %s: expected a cache hit, but %q misses", req.Method, req.URL, get.Key)
+	default:
+		if set, ok := firstOp(ops, OpSet); ok {
+			t.Errorf("cachetest: %s %s: expected a cache hit, but %q is stored", req.Method, req.URL, set.Key)
+		}
+	}
+	return w
+}
+
+// AssertMiss serves the request, and asserts the lookup misses.
+func AssertMiss(t testing.TB, store *Store, h http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	w, ops := Perform(store, h, req)
+	get, ok := firstOp(ops, OpGet)
+	switch {
+	case !ok:
+		t.Errorf("cachetest: %s %s: expected a cache miss, but the store is not looked up", req.Method, req.URL)
+	case get.Hit:
+		t.Errorf("cachetest: %s %s: expected a cache miss, but %q hits", req.Method, req.URL, get.Key)
+	}
+	return w
+}
+
+// AssertKey serves the request, and asserts the store is looked up with key.
+func AssertKey(t testing.TB, store *Store, h http.Handler, req *http.Request, key string) *httptest.ResponseRecorder {
+	t.Helper()
+	w, ops := Perform(store, h, req)
+	get, ok := firstOp(ops, OpGet)
+	switch {
+	case !ok:
+		t.Errorf("cachetest: %s %s: expected key %q, but the store is not looked up", req.Method, req.URL, key)
+	case get.Key != key:
+		t.Errorf("cachetest: %s %s: expected key %q, but got %q", req.Method, req.URL, key, get.Key)
+	}
+	return w
+}
+
+// AssertStoredTTL asserts the latest Set of key is with the expiration ttl.
+func AssertStoredTTL(t testing.TB, store *Store, key string, ttl time.Duration) bool {
+	t.Helper()
+	ops := store.Ops()
+	for i := len(ops) - 1; i >= 0; i-- {
+		if ops[i].Kind == OpSet && ops[i].Key == key {
+			if ops[i].TTL != ttl {
+				t.Errorf("cachetest: %q: expected stored with ttl %s, but got %s", key, ttl, ops[i].TTL)
+				return false
+			}
+			return true
+		}
+	}
+	t.Errorf("cachetest: %q: expected stored with ttl %s, but it is never stored", key, ttl)
+	return false
+}
+
+func firstOp(ops []Op, kind OpKind) (Op, bool) {
+	for _, op := range ops {
+		if op.Kind == kind {
+			return op, true
+		}
+	}
+	return Op{}, false
+}
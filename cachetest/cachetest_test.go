@@ -0,0 +1,105 @@
+package cachetest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	cache "github.com/things-go/gin-cache"
+	"github.com/things-go/gin-cache/persist"
+)
+
+// failT records the failures instead of failing the test.
+type failT struct {
+	*testing.T
+	errors []string
+}
+
+func (t *failT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func newEngine(store *Store) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/cache", cache.CacheWithRequestURI(store, time.Minute, func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	}))
+	r.GET("/nocache", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+	return r
+}
+
+func TestAssert(t *testing.T) {
+	store := NewStore()
+	r := newEngine(store)
+	key := cache.GenerateKeyWithPrefix(cache.PageCachePrefix, url.QueryEscape("/cache"))
+
+	w := AssertMiss(t, store, r, httptest.NewRequest(http.MethodGet, "/cache", nil))
+	require.Equal(t, "pong", w.Body.String())
+	AssertStoredTTL(t, store, key, time.Minute)
+	w = AssertHit(t, store, r, httptest.NewRequest(http.MethodGet, "/cache", nil))
+	require.Equal(t, "pong", w.Body.String())
+	AssertKey(t, store, r, httptest.NewRequest(http.MethodGet, "/cache", nil), key)
+
+	// the entry expires by the clock.
+	store.Clock().Advance(time.Minute)
+	AssertMiss(t, store, r, httptest.NewRequest(http.MethodGet, "/cache", nil))
+}
+
+func TestAssertFailure(t *testing.T) {
+	store := NewStore()
+	r := newEngine(store)
+
+	ft := &failT{T: t}
+	AssertHit(ft, store, r, httptest.NewRequest(http.MethodGet, "/cache", nil))
+	AssertMiss(ft, store, r, httptest.NewRequest(http.MethodGet, "/cache", nil))
+	AssertKey(ft, store, r, httptest.NewRequest(http.MethodGet, "/cache", nil), "other")
+	AssertHit(ft, store, r, httptest.NewRequest(http.MethodGet, "/nocache", nil))
+	AssertStoredTTL(ft, store, cache.GenerateKeyWithPrefix(cache.PageCachePrefix, url.QueryEscape("/cache")), time.Hour)
+	AssertStoredTTL(ft, store, "other", time.Hour)
+	require.Len(t, ft.errors, 6)
+	require.Contains(t, ft.errors[0], "misses")
+	require.Contains(t, ft.errors[1], "hits")
+	require.Contains(t, ft.errors[2], `but got "`)
+	require.Contains(t, ft.errors[3], "not looked up")
+	require.Contains(t, ft.errors[4], "but got 1m0s")
+	require.Contains(t, ft.errors[5], "never stored")
+}
+
+func TestStore(t *testing.T) {
+	clock := NewClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := NewStore(WithClock(clock))
+
+	require.NoError(t, store.Set("a", "v", time.Second))
+	require.NoError(t, store.Set("forever", "v", persist.NoExpiration))
+	var v string
+	require.NoError(t, store.Get("a", &v))
+	require.Equal(t, "v", v)
+	ttl, err := store.TTL("a")
+	require.NoError(t, err)
+	require.Equal(t, time.Second, ttl)
+
+	clock.Advance(time.Second)
+	require.ErrorIs(t, store.Get("a", &v), persist.ErrCacheMiss)
+	require.NoError(t, store.Get("forever", &v))
+	require.NoError(t, store.Delete("forever"))
+
+	require.Equal(t, []Op{
+		{Kind: OpSet, Key: "a", TTL: time.Second},
+		{Kind: OpSet, Key: "forever", TTL: persist.NoExpiration},
+		{Kind: OpGet, Key: "a", Hit: true},
+		{Kind: OpGet, Key: "a"},
+		{Kind: OpGet, Key: "forever", Hit: true},
+		{Kind: OpDelete, Key: "forever"},
+	}, store.Ops())
+	store.Reset()
+	require.Empty(t, store.Ops())
+}
@@ -0,0 +1,172 @@
+// Package cachetest provides helpers for asserting the cache behavior in application tests,
+// a recording in-memory store, a manual clock, and assertions on the requests served by
+// any gin engine which uses the middleware with the recording store.
+package cachetest
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/things-go/gin-cache/persist"
+)
+
+// OpKind the kind of a store operation.
+type OpKind int
+
+const (
+	// OpGet Store.Get
+	OpGet OpKind = iota + 1
+	// OpSet Store.Set
+	OpSet
+	// OpDelete Store.Delete
+	OpDelete
+)
+
+// String implement fmt.Stringer interface.
+func (k OpKind) String() string {
+	switch k {
+	case OpGet:
+		return "get"
+	case OpSet:
+		return "set"
+	case OpDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// Op a recorded store operation.
+type Op struct {
+	Kind OpKind
+	Key  string
+	// TTL the expiration of OpSet.
+	TTL time.Duration
+	// Hit whether OpGet found the key.
+	Hit bool
+}
+
+// Store a recording in-memory store, which logs every Get, Set and Delete,
+// the items expire by its clock.
+type Store struct {
+	clock *Clock
+
+	mu    sync.Mutex
+	items map[string]item
+	ops   []Op
+}
+
+type item struct {
+	value    any
+	expireAt time.Time // zero means never expires.
+}
+
+// Option custom option
+type Option func(*Store)
+
+// WithClock custom the clock of the expiration, default is a manual clock starting at time.Now().
+func WithClock(c *Clock) Option {
+	return func(s *Store) {
+		if c != nil {
+			s.clock = c
+		}
+	}
+}
+
+var _ persist.Store = (*Store)(nil)
+var _ persist.TTLer = (*Store)(nil)
+
+// NewStore new recording in-memory store.
+func NewStore(opts ...Option) *Store {
+	s := &Store{items: make(map[string]item)}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.clock == nil {
+		s.clock = NewClock(time.Now())
+	}
+	return s
+}
+
+// Clock returns the clock of the expiration.
+func (s *Store) Clock() *Clock { return s.clock }
+
+// Ops returns a copy of the recorded operations in order.
+func (s *Store) Ops() []Op {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Op(nil), s.ops...)
+}
+
+// Reset drops the recorded operations, the items are kept.
+func (s *Store) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ops = nil
+}
+
+// Set implement persist.Store interface, the item never expires if expire <= 0.
+func (s *Store) Set(key string, value any, expire time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ops = append(s.ops, Op{Kind: OpSet, Key: key, TTL: expire})
+	it := item{value: value}
+	if expire > 0 {
+		it.expireAt = s.clock.Now().Add(expire)
+	}
+	s.items[key] = it
+	return nil
+}
+
+// Get implement persist.Store interface
+func (s *Store) Get(key string, value any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, ok := s.lookup(key)
+	s.ops = append(s.ops, Op{Kind: OpGet, Key: key, Hit: ok})
+	if !ok {
+		return persist.ErrCacheMiss
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Type().Kind() == reflect.Ptr && v.Elem().CanSet() {
+		v.Elem().Set(reflect.Indirect(reflect.ValueOf(it.value)))
+	}
+	return nil
+}
+
+// Delete implement persist.Store interface
+func (s *Store) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ops = append(s.ops, Op{Kind: OpDelete, Key: key})
+	delete(s.items, key)
+	return nil
+}
+
+// TTL implement persist.TTLer interface, which is not recorded.
+func (s *Store) TTL(key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, ok := s.lookup(key)
+	if !ok {
+		return 0, persist.ErrCacheMiss
+	}
+	if it.expireAt.IsZero() {
+		return persist.NoExpiration, nil
+	}
+	return it.expireAt.Sub(s.clock.Now()), nil
+}
+
+func (s *Store) lookup(key string) (item, bool) {
+	it, ok := s.items[key]
+	if !ok {
+		return item{}, false
+	}
+	if !it.expireAt.IsZero() && !it.expireAt.After(s.clock.Now()) {
+		delete(s.items, key)
+		return item{}, false
+	}
+	return it, true
+}
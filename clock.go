@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/things-go/gin-cache/persist"
+)
+
+// WithClock custom the time source, which stamps the creation time of the entries
+// and computes their age, default is persist.SystemClock.
+// use a manual clock, such as cachetest.Clock, in tests.
+func WithClock(clock persist.Clock) Option {
+	return func(c *Config) {
+		if clock != nil {
+			c.clock = clock
+		}
+	}
+}
+
+// age the age of the entry in seconds, which is never negative.
+func (cfg *Config) age(bodyCache *BodyCache) int64 {
+	age := cfg.clock.Now().Sub(bodyCache.CreatedAt)
+	if age < 0 {
+		return 0
+	}
+	return int64(age / time.Second)
+}
+
+// setAge sets the Age header of the entry, the entries stored without the creation time have no Age.
+func (cfg *Config) setAge(c *gin.Context, bodyCache *BodyCache) {
+	if bodyCache.CreatedAt.IsZero() {
+		return
+	}
+	c.Writer.Header().Set("Age", strconv.FormatInt(cfg.age(bodyCache), 10))
+}
@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Compression the content coding used to store the response body.
+type Compression int
+
+const (
+	// CompressNone store the response body as it is.
+	CompressNone Compression = iota
+	// CompressGzip store the response body with gzip content coding.
+	CompressGzip
+	// CompressDeflate store the response body with deflate content coding, which is the zlib format.
+	CompressDeflate
+)
+
+// String returns the content coding name.
+func (cp Compression) String() string {
+	switch cp {
+	case CompressGzip:
+		return "gzip"
+	case CompressDeflate:
+		return "deflate"
+	default:
+		return ""
+	}
+}
+
+// WithCompression store the response body compressed once if the body size is not less than minSize,
+// and the response has no Content-Encoding. the compressed body is served as it is to the clients which
+// accept the content coding, and decompressed on the fly for the others.
+// default is CompressNone.
+func WithCompression(cp Compression, minSize int) Option {
+	return func(c *Config) {
+		c.compression = cp
+		c.compressMinSize = minSize
+	}
+}
+
+// compress the body of the BodyCache which is going to be stored.
+func (cfg *Config) compress(bc *BodyCache) {
+	if cfg.compression == CompressNone ||
+		len(bc.Data) < cfg.compressMinSize ||
+		bc.Header.Get("Content-Encoding") != "" {
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	var w io.WriteCloser
+	switch cfg.compression {
+	case CompressGzip:
+		w = gzip.NewWriter(buf)
+	case CompressDeflate:
+		w = zlib.NewWriter(buf)
+	default:
+		return
+	}
+	if _, err := w.Write(bc.Data); err != nil {
+		return
+	}
+	if err := w.Close(); err != nil {
+		return
+	}
+
+	bc.Data = buf.Bytes()
+	bc.Header.Set("Content-Encoding", cfg.compression.String())
+	bc.Header.Del("Content-Length")
+	if !headerContainsToken(bc.Header, "Vary", "Accept-Encoding") {
+		bc.Header.Add("Vary", "Accept-Encoding")
+	}
+}
+
+// decompressReader returns the reader of the decompressed body,
+// if the body is compressed and the client does not accept the content coding.
+// it is decided by the stored entry, so the entries stored compressed are still decompressed
+// after the compression is turned off.
+func (cfg *Config) decompressReader(c *gin.Context, bc *BodyCache) (io.ReadCloser, bool) {
+	coding := bc.Header.Get("Content-Encoding")
+	if coding == "" || acceptsEncoding(c.Request.Header.Get("Accept-Encoding"), coding) {
+		return nil, false
+	}
+	switch strings.ToLower(coding) {
+	case "gzip":
+		r, err := gzip.NewReader(bytes.NewReader(bc.Data))
+		if err != nil {
+			return nil, false
+		}
+		return r, true
+	case "deflate":
+		r, err := zlib.NewReader(bytes.NewReader(bc.Data))
+		if err != nil {
+			return nil, false
+		}
+		return r, true
+	default:
+		return nil, false
+	}
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header value accepts the content coding.
+func acceptsEncoding(acceptEncoding, coding string) bool {
+	var accepted, explicit, wildcard bool
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.TrimSpace(name)
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(k), "q") {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+					q = f
+				}
+			}
+		}
+		switch {
+		case strings.EqualFold(name, coding):
+			explicit, accepted = true, q > 0
+		case name == "*":
+			wildcard = q > 0
+		}
+	}
+	if explicit {
+		return accepted
+	}
+	return wildcard
+}
+
+// headerContainsToken reports whether the comma separated header values contain the token.
+func headerContainsToken(h http.Header, key, token string) bool {
+	for _, v := range h.Values(key) {
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if t == "*" || strings.EqualFold(t, token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func performRequestWithHeader(target string, router *gin.Engine, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestCacheCompression(t *testing.T) {
+	body := strings.Repeat("hello world ", 100)
+
+	for _, tt := range []struct {
+		compression Compression
+		coding      string
+	}{
+		{CompressGzip, "gzip"},
+		{CompressDeflate, "deflate"},
+	} {
+		t.Run(tt.coding, func(t *testing.T) {
+			store := newBinaryStore()
+			r := gin.New()
+			r.GET("/cache/compress", Cache(store, time.Second*3, func(c *gin.Context) {
+				c.String(http.StatusOK, body)
+			}, WithCompression(tt.compression, 64)))
+
+			w1 := performRequest("/cache/compress", r)
+			assert.Equal(t, body, w1.Body.String())
+			assert.Empty(t, w1.Header().Get("Content-Encoding"))
+
+			// served as it is.
+			w2 := performRequestWithHeader("/cache/compress", r, http.Header{
+				"Accept-Encoding": {"br;q=1.0, " + tt.coding + ";q=0.5"},
+			})
+			assert.Equal(t, tt.coding, w2.Header().Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", w2.Header().Get("Vary"))
+			assert.Less(t, w2.Body.Len(), len(body))
+			assert.Equal(t, body, decodeBody(t, tt.coding, w2.Body.Bytes()))
+
+			// decompressed on the fly.
+			w3 := performRequestWithHeader("/cache/compress", r, http.Header{
+				"Accept-Encoding": {"*, " + tt.coding + ";q=0"},
+			})
+			assert.Empty(t, w3.Header().Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", w3.Header().Get("Vary"))
+			assert.Equal(t, body, w3.Body.String())
+		})
+	}
+}
+
+func TestCacheCompressionThreshold(t *testing.T) {
+	r := gin.New()
+	r.GET("/cache/compress", Cache(newBinaryStore(), time.Second*3, func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	}, WithCompression(CompressGzip, 64)))
+
+	performRequest("/cache/compress", r)
+	w := performRequestWithHeader("/cache/compress", r, http.Header{"Accept-Encoding": {"gzip"}})
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "pong", w.Body.String())
+}
+
+func TestCacheCompressionPrecompressed(t *testing.T) {
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	_, err := zw.Write([]byte(strings.Repeat("a", 128)))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	r := gin.New()
+	r.GET("/cache/compress", Cache(newBinaryStore(), time.Second*3, func(c *gin.Context) {
+		c.Header("Content-Encoding", "gzip")
+		c.Data(http.StatusOK, "text/plain", buf.Bytes())
+	}, WithCompression(CompressGzip, 64)))
+
+	performRequest("/cache/compress", r)
+	w := performRequestWithHeader("/cache/compress", r, http.Header{"Accept-Encoding": {"gzip"}})
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, buf.Bytes(), w.Body.Bytes())
+
+	zr, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	got, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("a", 128), string(got))
+}
+
+// decodeBody decodes the body of the content coding as the clients following the spec do.
+func decodeBody(t *testing.T, coding string, data []byte) string {
+	var r io.Reader
+	var err error
+	switch coding {
+	case "gzip":
+		r, err = gzip.NewReader(bytes.NewReader(data))
+	case "deflate":
+		r, err = zlib.NewReader(bytes.NewReader(data))
+	}
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(got)
+}
+
+func TestCacheCompressionPrecompressedDeflate(t *testing.T) {
+	body := strings.Repeat("a", 128)
+	buf := &bytes.Buffer{}
+	zw := zlib.NewWriter(buf)
+	_, err := zw.Write([]byte(body))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	r := gin.New()
+	r.GET("/cache/compress", Cache(newBinaryStore(), time.Second*3, func(c *gin.Context) {
+		c.Header("Content-Encoding", "deflate")
+		c.Data(http.StatusOK, "text/plain", buf.Bytes())
+	}, WithCompression(CompressDeflate, 64)))
+
+	performRequest("/cache/compress", r)
+	w := performRequestWithHeader("/cache/compress", r, http.Header{"Accept-Encoding": {"deflate"}})
+	assert.Equal(t, "deflate", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, buf.Bytes(), w.Body.Bytes())
+
+	// decompressed on the fly.
+	w = performRequest("/cache/compress", r)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, body, w.Body.String())
+}
+
+func TestCacheCompressionTurnedOff(t *testing.T) {
+	body := strings.Repeat("hello world ", 100)
+	store := newBinaryStore()
+	handler := func(c *gin.Context) {
+		c.String(http.StatusOK, body)
+	}
+	on := gin.New()
+	on.GET("/cache/compress", Cache(store, time.Second*3, handler, WithCompression(CompressGzip, 64)))
+	off := gin.New()
+	off.GET("/cache/compress", Cache(store, time.Second*3, handler))
+
+	performRequest("/cache/compress", on)
+	// the entry stored compressed is still decompressed for the clients which do not accept it.
+	w := performRequest("/cache/compress", off)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, body, w.Body.String())
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		want           bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"GZIP", true},
+		{"deflate, gzip;q=0.5", true},
+		{"gzip;q=0", false},
+		{"gzip; q=0.0", false},
+		{"*", true},
+		{"*;q=0", false},
+		{"*, gzip;q=0", false},
+		{"br", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, acceptsEncoding(tt.acceptEncoding, "gzip"), tt.acceptEncoding)
+	}
+}
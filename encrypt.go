@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Encrypted layout: version(1 byte) | key id(4 bytes, big endian) | nonce | sealed payload
+// the version and key id are authenticated as additional data.
+const (
+	encryptVersion    = 1
+	encryptHeaderSize = 5
+)
+
+// ErrDecrypt the entry can not be decrypted, which is tampered, corrupt or sealed by an unknown key.
+var ErrDecrypt = errors.New("gincache: decrypt body cache failed")
+
+// Key an AES key with its identifier, the secret must be 16, 24 or 32 bytes.
+type Key struct {
+	ID     uint32
+	Secret []byte
+}
+
+// KeyRing the keys for EncryptedEncoding, the newest key seals new entries,
+// all keys open the entries.
+type KeyRing struct {
+	newest uint32
+	aeads  map[uint32]cipher.AEAD
+}
+
+// NewKeyRing new key ring, the last key is the newest one.
+// rotate the key by appending a new key, and remove the old key after
+// all entries sealed by it expired.
+func NewKeyRing(keys ...Key) (*KeyRing, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("gincache: key ring needs one key at least")
+	}
+	kr := &KeyRing{aeads: make(map[uint32]cipher.AEAD, len(keys))}
+	for _, k := range keys {
+		if _, dup := kr.aeads[k.ID]; dup {
+			return nil, fmt.Errorf("gincache: duplicate key id %d", k.ID)
+		}
+		block, err := aes.NewCipher(k.Secret)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		kr.aeads[k.ID] = aead
+		kr.newest = k.ID
+	}
+	return kr, nil
+}
+
+// EncryptedEncoding an Encoding decorator which seals the serialized entry with AES-GCM.
+type EncryptedEncoding struct {
+	encode Encoding
+	ring   *KeyRing
+}
+
+var _ Encoding = (*EncryptedEncoding)(nil)
+
+// NewEncryptedEncoding new encrypted encoding which seals the data serialized by encode.
+func NewEncryptedEncoding(encode Encoding, ring *KeyRing) *EncryptedEncoding {
+	return &EncryptedEncoding{encode, ring}
+}
+
+// Marshal implement Encoding interface.
+func (e *EncryptedEncoding) Marshal(v any) ([]byte, error) {
+	plain, err := e.encode.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	aead := e.ring.aeads[e.ring.newest]
+
+	nonceSize := aead.NonceSize()
+	data := make([]byte, encryptHeaderSize+nonceSize, encryptHeaderSize+nonceSize+len(plain)+aead.Overhead())
+	data[0] = encryptVersion
+	binary.BigEndian.PutUint32(data[1:encryptHeaderSize], e.ring.newest)
+	nonce := data[encryptHeaderSize:]
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(data, nonce, plain, data[:encryptHeaderSize]), nil
+}
+
+// Unmarshal implement Encoding interface.
+func (e *EncryptedEncoding) Unmarshal(data []byte, v any) error {
+	if len(data) < encryptHeaderSize {
+		return fmt.Errorf("%w: too short", ErrDecrypt)
+	}
+	if data[0] != encryptVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrDecrypt, data[0])
+	}
+	id := binary.BigEndian.Uint32(data[1:encryptHeaderSize])
+	aead, ok := e.ring.aeads[id]
+	if !ok {
+		return fmt.Errorf("%w: unknown key id %d", ErrDecrypt, id)
+	}
+	nonceSize := aead.NonceSize()
+	if len(data) < encryptHeaderSize+nonceSize {
+		return fmt.Errorf("%w: too short", ErrDecrypt)
+	}
+	nonce := data[encryptHeaderSize : encryptHeaderSize+nonceSize]
+	plain, err := aead.Open(nil, nonce, data[encryptHeaderSize+nonceSize:], data[:encryptHeaderSize])
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDecrypt, err)
+	}
+	return e.encode.Unmarshal(plain, v)
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedEncoding(t *testing.T) {
+	want := BodyCache{
+		Status: http.StatusOK,
+		Header: http.Header{"Content-Type": {"text/plain"}},
+		Data:   []byte("secret: 42"),
+	}
+
+	oldRing, err := NewKeyRing(Key{1, bytes.Repeat([]byte{1}, 32)})
+	require.NoError(t, err)
+	newRing, err := NewKeyRing(Key{1, bytes.Repeat([]byte{1}, 32)}, Key{2, bytes.Repeat([]byte{2}, 16)})
+	require.NoError(t, err)
+
+	oldEncode := NewEncryptedEncoding(JSONEncoding{}, oldRing)
+	newEncode := NewEncryptedEncoding(JSONEncoding{}, newRing)
+
+	data, err := oldEncode.Marshal(want)
+	require.NoError(t, err)
+	assert.False(t, bytes.Contains(data, []byte("secret")))
+
+	// old entries still decrypt after rotation.
+	got := BodyCache{}
+	require.NoError(t, newEncode.Unmarshal(data, &got))
+	require.Equal(t, want, got)
+
+	// new writes use the newest key.
+	data, err = newEncode.Marshal(want)
+	require.NoError(t, err)
+	got = BodyCache{}
+	require.NoError(t, newEncode.Unmarshal(data, &got))
+	require.Equal(t, want, got)
+	require.ErrorIs(t, oldEncode.Unmarshal(data, &got), ErrDecrypt)
+
+	// tampered.
+	data[len(data)-1] ^= 0xff
+	require.ErrorIs(t, newEncode.Unmarshal(data, &got), ErrDecrypt)
+	require.ErrorIs(t, newEncode.Unmarshal(data[:3], &got), ErrDecrypt)
+}
+
+func TestNewKeyRing(t *testing.T) {
+	_, err := NewKeyRing()
+	require.Error(t, err)
+	_, err = NewKeyRing(Key{1, []byte("short")})
+	require.Error(t, err)
+	_, err = NewKeyRing(Key{1, bytes.Repeat([]byte{1}, 16)}, Key{1, bytes.Repeat([]byte{2}, 16)})
+	require.Error(t, err)
+}
+
+func TestCacheEncryptedEncoding(t *testing.T) {
+	ring, err := NewKeyRing(Key{1, bytes.Repeat([]byte{1}, 32)})
+	require.NoError(t, err)
+	otherRing, err := NewKeyRing(Key{2, bytes.Repeat([]byte{2}, 32)})
+	require.NoError(t, err)
+
+	store := newBinaryStore()
+	count := 0
+	handler := func(c *gin.Context) {
+		count++
+		c.String(http.StatusOK, "pong")
+	}
+
+	r := gin.New()
+	r.GET("/cache/encrypt", Cache(store, time.Second*3, handler,
+		WithEncoding(NewEncryptedEncoding(BinaryEncoding{}, ring))))
+	r.GET("/cache/other", Cache(store, time.Second*3, handler,
+		WithEncoding(NewEncryptedEncoding(BinaryEncoding{}, otherRing)),
+		WithGenerateKey(func(c *gin.Context) (string, bool) {
+			return GenerateKeyWithPrefix(PageCachePrefix, "%2Fcache%2Fencrypt"), true
+		})))
+
+	performRequest("/cache/encrypt", r)
+	w := performRequest("/cache/encrypt", r)
+	assert.Equal(t, "pong", w.Body.String())
+	assert.Equal(t, 1, count)
+
+	// fails authentication, treated as a miss.
+	w = performRequest("/cache/other", r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "pong", w.Body.String())
+	assert.Equal(t, 2, count)
+}
@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Built-in codec identifiers, 0 is reserved.
+const (
+	CodecJSON     uint8 = 1
+	CodecJSONGzip uint8 = 2
+)
+
+// Envelope layout: magic(2 bytes) | version(1 byte) | codec id(1 byte) | flags(1 byte) | payload
+const (
+	envelopeMagic0     = 0xca
+	envelopeMagic1     = 0xc8
+	envelopeVersion    = 1
+	envelopeHeaderSize = 5
+)
+
+// ErrUnknownCodec the envelope codec identifier is not registered.
+var ErrUnknownCodec = errors.New("gincache: unknown codec")
+
+// Codec an Encoding with a stable identifier, which is written into the entry envelope.
+type Codec interface {
+	Encoding
+	// CodecID the stable identifier of the codec, 0 is reserved.
+	CodecID() uint8
+}
+
+var codecs = struct {
+	sync.RWMutex
+	m map[uint8]Codec
+}{
+	m: map[uint8]Codec{
+		CodecJSON:     JSONEncoding{},
+		CodecJSONGzip: JSONGzipEncoding{},
+		CodecBinary:   BinaryEncoding{},
+	},
+}
+
+// RegisterCodec register a codec, so the envelope written by it can be decoded.
+// it panics if the codec is nil, the identifier is 0 or already registered.
+func RegisterCodec(c Codec) {
+	if c == nil {
+		panic("gincache: register codec is nil")
+	}
+	id := c.CodecID()
+	if id == 0 {
+		panic("gincache: codec id 0 is reserved")
+	}
+	codecs.Lock()
+	defer codecs.Unlock()
+	if _, dup := codecs.m[id]; dup {
+		panic(fmt.Sprintf("gincache: register codec twice for id %d", id))
+	}
+	codecs.m[id] = c
+}
+
+func lookupCodec(id uint8) (Codec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	c, ok := codecs.m[id]
+	return c, ok
+}
+
+// EnvelopeEncoding an Encoding which writes entries in a self-describing envelope,
+// the envelope records the format version and the codec identifier,
+// so it decodes the entries written by any registered codec, which allows rolling
+// encoding migrations. the entries without envelope are decoded with its own codec.
+type EnvelopeEncoding struct {
+	codec Codec
+}
+
+var _ Encoding = (*EnvelopeEncoding)(nil)
+
+// NewEnvelopeEncoding new envelope encoding which writes the entries with the codec.
+// the codec needs not to be registered, but the other readers must register it.
+func NewEnvelopeEncoding(c Codec) *EnvelopeEncoding {
+	return &EnvelopeEncoding{c}
+}
+
+// Marshal implement Encoding interface.
+func (e *EnvelopeEncoding) Marshal(v any) ([]byte, error) {
+	payload, err := e.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, envelopeHeaderSize, envelopeHeaderSize+len(payload))
+	data[0] = envelopeMagic0
+	data[1] = envelopeMagic1
+	data[2] = envelopeVersion
+	data[3] = e.codec.CodecID()
+	data[4] = 0 // flags, reserved
+	return append(data, payload...), nil
+}
+
+// Unmarshal implement Encoding interface.
+func (e *EnvelopeEncoding) Unmarshal(data []byte, v any) error {
+	if len(data) < envelopeHeaderSize || data[0] != envelopeMagic0 || data[1] != envelopeMagic1 {
+		// no envelope, written before enabled the envelope.
+		return e.codec.Unmarshal(data, v)
+	}
+	if version := data[2]; version != envelopeVersion {
+		return fmt.Errorf("gincache: unsupported envelope version %d", version)
+	}
+	if flags := data[4]; flags != 0 {
+		return fmt.Errorf("gincache: unsupported envelope flags %#x", flags)
+	}
+
+	id := data[3]
+	codec := e.codec
+	if id != codec.CodecID() {
+		var ok bool
+		if codec, ok = lookupCodec(id); !ok {
+			return fmt.Errorf("%w: %d", ErrUnknownCodec, id)
+		}
+	}
+	return codec.Unmarshal(data[envelopeHeaderSize:], v)
+}
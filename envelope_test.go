@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type reverseCodec struct{}
+
+func (reverseCodec) Marshal(v any) ([]byte, error) {
+	data, err := JSONEncoding{}.Marshal(v)
+	for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+		data[i], data[j] = data[j], data[i]
+	}
+	return data, err
+}
+
+func (reverseCodec) Unmarshal(data []byte, v any) error {
+	b := make([]byte, len(data))
+	for i := range data {
+		b[len(data)-1-i] = data[i]
+	}
+	return JSONEncoding{}.Unmarshal(b, v)
+}
+
+func (reverseCodec) CodecID() uint8 { return 200 }
+
+func TestEnvelopeEncoding(t *testing.T) {
+	want := BodyCache{
+		Status: 200,
+		Header: map[string][]string{"Content-Type": {"text/plain"}},
+		Data:   []byte("hello world"),
+	}
+
+	jsonEnvelope := NewEnvelopeEncoding(JSONEncoding{})
+	gzipEnvelope := NewEnvelopeEncoding(JSONGzipEncoding{})
+
+	// rolling migration, read the entries written by the other codec
+	for _, w := range []Encoding{jsonEnvelope, gzipEnvelope} {
+		data, err := w.Marshal(want)
+		require.NoError(t, err)
+		for _, r := range []Encoding{jsonEnvelope, gzipEnvelope} {
+			got := BodyCache{}
+			err = r.Unmarshal(data, &got)
+			require.NoError(t, err)
+			require.Equal(t, want, got)
+		}
+	}
+
+	// the entries written before enabled the envelope.
+	data, err := JSONGzipEncoding{}.Marshal(want)
+	require.NoError(t, err)
+	got := BodyCache{}
+	err = gzipEnvelope.Unmarshal(data, &got)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+}
+
+func TestEnvelopeEncodingCodec(t *testing.T) {
+	want := BodyCache{Status: 200, Data: []byte("hello world")}
+
+	data, err := NewEnvelopeEncoding(reverseCodec{}).Marshal(want)
+	require.NoError(t, err)
+
+	got := BodyCache{}
+	err = NewEnvelopeEncoding(JSONEncoding{}).Unmarshal(data, &got)
+	require.True(t, errors.Is(err, ErrUnknownCodec))
+
+	RegisterCodec(reverseCodec{})
+	err = NewEnvelopeEncoding(JSONEncoding{}).Unmarshal(data, &got)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	require.Panics(t, func() { RegisterCodec(reverseCodec{}) })
+	require.Panics(t, func() { RegisterCodec(nil) })
+
+	bad := append([]byte{}, data...)
+	bad[2] = envelopeVersion + 1
+	require.Error(t, NewEnvelopeEncoding(JSONEncoding{}).Unmarshal(bad, &got))
+}
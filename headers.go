@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"net/http"
+	"strings"
+)
+
+// SetCookiePolicy how to handle the response with Set-Cookie.
+type SetCookiePolicy int
+
+const (
+	// SetCookieSkip neither store nor share the response with Set-Cookie.
+	SetCookieSkip SetCookiePolicy = iota
+	// SetCookieStrip store and share the response with Set-Cookie removed.
+	SetCookieStrip
+)
+
+// hopByHopHeaders the headers which are meaningful only for a single connection,
+// which are never stored.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// HeaderPolicy which response headers are stored, the hop-by-hop headers are never stored.
+type HeaderPolicy struct {
+	// SetCookie how to handle the response with Set-Cookie, default: SetCookieSkip.
+	SetCookie SetCookiePolicy
+	// Allow only the listed headers are stored if not empty.
+	Allow []string
+	// Deny the listed headers are never stored.
+	Deny []string
+}
+
+// WithHeaderPolicy custom header policy, default policy skips the response with Set-Cookie.
+func WithHeaderPolicy(p HeaderPolicy) Option {
+	return func(c *Config) {
+		c.headerPolicy = newHeaderPolicy(p)
+	}
+}
+
+type headerPolicy struct {
+	setCookie SetCookiePolicy
+	allow     map[string]struct{}
+	deny      map[string]struct{}
+}
+
+func newHeaderPolicy(p HeaderPolicy) headerPolicy {
+	canonical := func(keys []string) map[string]struct{} {
+		if len(keys) == 0 {
+			return nil
+		}
+		m := make(map[string]struct{}, len(keys))
+		for _, k := range keys {
+			m[http.CanonicalHeaderKey(k)] = struct{}{}
+		}
+		return m
+	}
+	return headerPolicy{
+		setCookie: p.SetCookie,
+		allow:     canonical(p.Allow),
+		deny:      canonical(p.Deny),
+	}
+}
+
+// sanitize removes the headers which must not be stored,
+// returns false if the response must not be stored.
+func (p *headerPolicy) sanitize(h http.Header) bool {
+	if _, ok := h["Set-Cookie"]; ok {
+		if p.setCookie == SetCookieSkip {
+			return false
+		}
+		delete(h, "Set-Cookie")
+	}
+
+	for _, v := range h.Values("Connection") {
+		for _, k := range strings.Split(v, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				delete(h, http.CanonicalHeaderKey(k))
+			}
+		}
+	}
+	for _, k := range hopByHopHeaders {
+		delete(h, k)
+	}
+
+	for k := range h {
+		if _, ok := p.deny[k]; ok {
+			delete(h, k)
+			continue
+		}
+		if p.allow != nil {
+			if _, ok := p.allow[k]; !ok {
+				delete(h, k)
+			}
+		}
+	}
+	return true
+}
+
+// HeaderMerge how to replay the cached headers into the headers which are already
+// set by the earlier middlewares, such as CORS or request id.
+type HeaderMerge int
+
+const (
+	// HeaderMergeKeepExisting the existing header is kept, the cached one is discarded.
+	HeaderMergeKeepExisting HeaderMerge = iota
+	// HeaderMergeReplace the cached header replaces the existing one.
+	HeaderMergeReplace
+	// HeaderMergeAppend the cached header values are appended to the existing one.
+	HeaderMergeAppend
+)
+
+// WithHeaderMerge custom how to replay the cached headers, default is HeaderMergeKeepExisting.
+// Content-Length is always set from the cached body.
+func WithHeaderMerge(m HeaderMerge) Option {
+	return func(c *Config) {
+		c.headerMerge = m
+	}
+}
+
+func (m HeaderMerge) merge(h http.Header, key string, values []string) {
+	existing, ok := h[key]
+	switch {
+	case !ok, m == HeaderMergeReplace:
+		// copy, the cached values may be shared with the store.
+		h[key] = append([]string(nil), values...)
+	case m == HeaderMergeAppend:
+		h[key] = append(existing, values...)
+	}
+}
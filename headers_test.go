@@ -0,0 +1,236 @@
+package cache
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/gin-cache/cachetest"
+)
+
+func TestCacheSetCookieSkip(t *testing.T) {
+	r := gin.New()
+	r.GET("/cache/cookie", Cache(newStore(time.Second*60), time.Second*3, func(c *gin.Context) {
+		c.SetCookie("session", fmt.Sprint(time.Now().UnixNano()), 3600, "/", "", false, true)
+		c.String(http.StatusOK, "pong "+fmt.Sprint(time.Now().UnixNano()))
+	}))
+
+	w1 := performRequest("/cache/cookie", r)
+	w2 := performRequest("/cache/cookie", r)
+
+	assert.NotEmpty(t, w1.Header().Get("Set-Cookie"))
+	assert.NotEmpty(t, w2.Header().Get("Set-Cookie"))
+	assert.NotEqual(t, w1.Header().Get("Set-Cookie"), w2.Header().Get("Set-Cookie"))
+	assert.NotEqual(t, w1.Body.String(), w2.Body.String())
+}
+
+func TestCacheSetCookieSkipSingleflight(t *testing.T) {
+	var mu sync.Mutex
+	n := 0
+	r := gin.New()
+	r.GET("/cache/cookie", Cache(newStore(time.Second*60), time.Second*3, func(c *gin.Context) {
+		mu.Lock()
+		n++
+		session := fmt.Sprint(n)
+		mu.Unlock()
+		time.Sleep(time.Millisecond * 50)
+		c.SetCookie("session", session, 3600, "/", "", false, true)
+		c.String(http.StatusOK, session)
+	}))
+
+	cookies := make(chan string, 5)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := performRequest("/cache/cookie", r)
+			cookies <- w.Header().Get("Set-Cookie")
+		}()
+	}
+	wg.Wait()
+	close(cookies)
+
+	// followers never share the leader's cookie.
+	seen := make(map[string]struct{})
+	for cookie := range cookies {
+		require.NotEmpty(t, cookie)
+		_, dup := seen[cookie]
+		require.False(t, dup, cookie)
+		seen[cookie] = struct{}{}
+	}
+}
+
+func TestCacheSetCookieStrip(t *testing.T) {
+	r := gin.New()
+	r.GET("/cache/cookie", Cache(newStore(time.Second*60), time.Second*3, func(c *gin.Context) {
+		c.SetCookie("session", "foo", 3600, "/", "", false, true)
+		c.String(http.StatusOK, "pong "+fmt.Sprint(time.Now().UnixNano()))
+	}, WithHeaderPolicy(HeaderPolicy{SetCookie: SetCookieStrip})))
+
+	w1 := performRequest("/cache/cookie", r)
+	w2 := performRequest("/cache/cookie", r)
+
+	assert.NotEmpty(t, w1.Header().Get("Set-Cookie"))
+	assert.Empty(t, w2.Header().Get("Set-Cookie"))
+	assert.Equal(t, w1.Body.String(), w2.Body.String())
+}
+
+func TestHeaderPolicySanitize(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy HeaderPolicy
+		header http.Header
+		want   http.Header
+		wantOk bool
+	}{
+		{
+			name:   "hop by hop",
+			header: http.Header{"Connection": {"close, X-Conn"}, "X-Conn": {"1"}, "Keep-Alive": {"timeout=5"}, "Transfer-Encoding": {"chunked"}, "X-Foo": {"bar"}},
+			want:   http.Header{"X-Foo": {"bar"}},
+			wantOk: true,
+		},
+		{
+			name:   "set cookie skip",
+			header: http.Header{"Set-Cookie": {"a=b"}},
+			wantOk: false,
+		},
+		{
+			name:   "set cookie strip",
+			policy: HeaderPolicy{SetCookie: SetCookieStrip},
+			header: http.Header{"Set-Cookie": {"a=b"}, "X-Foo": {"bar"}},
+			want:   http.Header{"X-Foo": {"bar"}},
+			wantOk: true,
+		},
+		{
+			name:   "deny",
+			policy: HeaderPolicy{Deny: []string{"x-request-id"}},
+			header: http.Header{"X-Request-Id": {"1"}, "X-Foo": {"bar"}},
+			want:   http.Header{"X-Foo": {"bar"}},
+			wantOk: true,
+		},
+		{
+			name:   "allow",
+			policy: HeaderPolicy{Allow: []string{"content-type", "x-foo"}, Deny: []string{"x-foo"}},
+			header: http.Header{"Content-Type": {"text/plain"}, "X-Request-Id": {"1"}, "X-Foo": {"bar"}},
+			want:   http.Header{"Content-Type": {"text/plain"}},
+			wantOk: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newHeaderPolicy(tt.policy)
+			ok := p.sanitize(tt.header)
+			require.Equal(t, tt.wantOk, ok)
+			if ok {
+				require.Equal(t, tt.want, tt.header)
+			}
+		})
+	}
+}
+
+func readRawResponse(t *testing.T, addr, target string) string {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n", target)
+	require.NoError(t, err)
+	raw, err := io.ReadAll(conn)
+	require.NoError(t, err)
+
+	// the Date header varies.
+	lines := strings.Split(string(raw), "\r\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "Date: ") {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\r\n")
+}
+
+func TestCacheHeaderReplayWire(t *testing.T) {
+	tests := []struct {
+		merge HeaderMerge
+		want  string
+	}{
+		{
+			HeaderMergeKeepExisting,
+			"HTTP/1.1 201 Created\r\n" +
+				"Access-Control-Allow-Origin: *\r\n" +
+				"Age: 5\r\n" +
+				"Content-Length: 4\r\n" +
+				"Content-Type: text/plain; charset=utf-8\r\n" +
+				"X-Cached: foo\r\n" +
+				"X-Request-Id: 2\r\n" +
+				"Connection: close\r\n" +
+				"\r\n" +
+				"pong",
+		},
+		{
+			HeaderMergeReplace,
+			"HTTP/1.1 201 Created\r\n" +
+				"Access-Control-Allow-Origin: https://example.com\r\n" +
+				"Age: 5\r\n" +
+				"Content-Length: 4\r\n" +
+				"Content-Type: text/plain; charset=utf-8\r\n" +
+				"X-Cached: foo\r\n" +
+				"X-Request-Id: 1\r\n" +
+				"Connection: close\r\n" +
+				"\r\n" +
+				"pong",
+		},
+		{
+			HeaderMergeAppend,
+			"HTTP/1.1 201 Created\r\n" +
+				"Access-Control-Allow-Origin: *\r\n" +
+				"Access-Control-Allow-Origin: https://example.com\r\n" +
+				"Age: 5\r\n" +
+				"Content-Length: 4\r\n" +
+				"Content-Type: text/plain; charset=utf-8\r\n" +
+				"X-Cached: foo\r\n" +
+				"X-Request-Id: 2\r\n" +
+				"X-Request-Id: 1\r\n" +
+				"Connection: close\r\n" +
+				"\r\n" +
+				"pong",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.merge), func(t *testing.T) {
+			requestID := 0
+			clock := cachetest.NewClock(time.Now())
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				requestID++
+				c.Header("Access-Control-Allow-Origin", "*")
+				c.Header("X-Request-Id", fmt.Sprint(requestID))
+			})
+			r.GET("/cache/wire", Cache(newBinaryStore(), time.Second*3, func(c *gin.Context) {
+				c.Header("Access-Control-Allow-Origin", "https://example.com")
+				c.Header("X-Cached", "foo")
+				c.String(http.StatusCreated, "pong")
+			}, WithHeaderMerge(tt.merge), WithEncoding(BinaryEncoding{}), WithClock(clock)))
+
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+			addr := strings.TrimPrefix(srv.URL, "http://")
+
+			readRawResponse(t, addr, "/cache/wire")
+			clock.Advance(5 * time.Second)
+			got := readRawResponse(t, addr, "/cache/wire")
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
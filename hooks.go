@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// HookFunc lifecycle event hook, bc may be nil when the event has no BodyCache.
+// bc is only valid during the call, do not retain or modify it.
+type HookFunc func(c *gin.Context, key string, bc *BodyCache)
+
+// ErrorHookFunc error event hook.
+type ErrorHookFunc func(c *gin.Context, key string, err error)
+
+// Hooks lifecycle event hooks, nil hook is ignored.
+type Hooks struct {
+	// OnHit called when the response is served from the store.
+	OnHit HookFunc
+	// OnMiss called when the store does not hold the key, before the handler runs, bc is nil.
+	OnMiss HookFunc
+	// OnStore called after the response has been written to the store successfully.
+	OnStore HookFunc
+	// OnEvict called after the middleware has deleted the key from the store, such as
+	// the entry can not be decoded, bc is nil.
+	OnEvict HookFunc
+	// OnError called when the store or the encoding fails.
+	OnError ErrorHookFunc
+}
+
+// WithHooks register a hook set, hook sets are called in the order they are registered.
+func WithHooks(h Hooks) Option {
+	return func(c *Config) {
+		c.hooks = append(c.hooks, h)
+	}
+}
+
+type hookSet []Hooks
+
+func (hs hookSet) hit(c *gin.Context, key string, bc *BodyCache) {
+	for _, h := range hs {
+		if h.OnHit != nil {
+			h.OnHit(c, key, bc)
+		}
+	}
+}
+
+func (hs hookSet) miss(c *gin.Context, key string) {
+	for _, h := range hs {
+		if h.OnMiss != nil {
+			h.OnMiss(c, key, nil)
+		}
+	}
+}
+
+func (hs hookSet) store(c *gin.Context, key string, bc *BodyCache) {
+	for _, h := range hs {
+		if h.OnStore != nil {
+			h.OnStore(c, key, bc)
+		}
+	}
+}
+
+func (hs hookSet) evict(c *gin.Context, key string) {
+	for _, h := range hs {
+		if h.OnEvict != nil {
+			h.OnEvict(c, key, nil)
+		}
+	}
+}
+
+func (hs hookSet) error(c *gin.Context, key string, err error) {
+	for _, h := range hs {
+		if h.OnError != nil {
+			h.OnError(c, key, err)
+		}
+	}
+}
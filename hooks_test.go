@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type errorStore struct {
+	err error
+}
+
+func (s errorStore) Get(string, any) error                { return s.err }
+func (s errorStore) Set(string, any, time.Duration) error { return s.err }
+func (s errorStore) Delete(string) error                  { return s.err }
+
+func TestCacheHooks(t *testing.T) {
+	store := newStore(time.Second * 60)
+
+	var events []string
+	hooks := Hooks{
+		OnHit: func(c *gin.Context, key string, bc *BodyCache) {
+			require.NotNil(t, bc)
+			events = append(events, "hit:"+string(bc.Data))
+		},
+		OnMiss: func(c *gin.Context, key string, bc *BodyCache) {
+			require.Nil(t, bc)
+			events = append(events, "miss")
+		},
+		OnStore: func(c *gin.Context, key string, bc *BodyCache) {
+			events = append(events, "store:"+string(bc.Data))
+		},
+		OnError: func(c *gin.Context, key string, err error) {
+			events = append(events, "error")
+		},
+	}
+
+	r := gin.New()
+	r.GET("/cache/hooks", Cache(store, time.Second*3, func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	}, WithHooks(hooks), WithHooks(Hooks{
+		OnHit: func(c *gin.Context, key string, bc *BodyCache) {
+			events = append(events, "second hit")
+		},
+	})))
+
+	w1 := performRequest("/cache/hooks", r)
+	w2 := performRequest("/cache/hooks", r)
+
+	assert.Equal(t, http.StatusOK, w1.Code)
+	assert.Equal(t, http.StatusOK, w2.Code)
+	assert.Equal(t, []string{"miss", "store:pong", "hit:pong", "second hit"}, events)
+}
+
+func TestCacheHooksError(t *testing.T) {
+	wantErr := errors.New("store unavailable")
+
+	var errs []error
+	r := gin.New()
+	r.GET("/cache/hooks", Cache(errorStore{wantErr}, time.Second*3, func(c *gin.Context) {
+		c.String(http.StatusOK, "pong "+fmt.Sprint(time.Now().UnixNano()))
+	}, WithHooks(Hooks{
+		OnStore: func(c *gin.Context, key string, bc *BodyCache) {
+			t.Fatal("should not store")
+		},
+		OnError: func(c *gin.Context, key string, err error) {
+			errs = append(errs, err)
+		},
+	})))
+
+	w := performRequest("/cache/hooks", r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, errs, 2)
+	assert.ErrorIs(t, errs[0], wantErr)
+	assert.ErrorIs(t, errs[1], wantErr)
+}
+
+func TestCacheEvictCorruptEntry(t *testing.T) {
+	store := newBinaryStore()
+
+	var evicted, decodeErrors int
+	r := gin.New()
+	r.GET("/cache/corrupt", Cache(store, time.Second*3, func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	}, WithHooks(Hooks{
+		OnEvict: func(c *gin.Context, key string, bc *BodyCache) {
+			evicted++
+		},
+		OnError: func(c *gin.Context, key string, err error) {
+			if errors.Is(err, ErrDecode) {
+				decodeErrors++
+			}
+		},
+	})))
+
+	w1 := performRequest("/cache/corrupt", r)
+	require.Equal(t, http.StatusOK, w1.Code)
+	require.Len(t, store.data, 1)
+	for k, v := range store.data {
+		store.data[k] = v[:len(v)/2] // truncated
+	}
+
+	w2 := performRequest("/cache/corrupt", r)
+	assert.Equal(t, http.StatusOK, w2.Code)
+	assert.Equal(t, "pong", w2.Body.String())
+	assert.Equal(t, 1, evicted)
+	assert.Equal(t, 1, decodeErrors)
+
+	// regenerated
+	w3 := performRequest("/cache/corrupt", r)
+	assert.Equal(t, "pong", w3.Body.String())
+	assert.Equal(t, 1, evicted)
+	assert.Equal(t, 1, decodeErrors)
+}
+
+// getHookStore runs afterGet once after a Get.
+type getHookStore struct {
+	*binaryStore
+	afterGet func()
+}
+
+func (s *getHookStore) Get(key string, value any) error {
+	err := s.binaryStore.Get(key, value)
+	if f := s.afterGet; f != nil {
+		s.afterGet = nil
+		f()
+	}
+	return err
+}
+
+func TestCacheCorruptEntryRegenerated(t *testing.T) {
+	store := &getHookStore{binaryStore: newBinaryStore()}
+
+	count, evicted := 0, 0
+	r := gin.New()
+	r.GET("/cache/corrupt", Cache(store, time.Second*3, func(c *gin.Context) {
+		count++
+		c.String(http.StatusOK, "pong %d", count)
+	}, WithHooks(Hooks{
+		OnEvict: func(c *gin.Context, key string, bc *BodyCache) {
+			evicted++
+		},
+	})))
+
+	require.Equal(t, "pong 1", performRequest("/cache/corrupt", r).Body.String())
+	for k, v := range store.data {
+		store.data[k] = v[:len(v)/2] // truncated
+		// another request regenerates the entry after the corrupt one is read.
+		store.afterGet = func() { store.data[k] = v }
+	}
+
+	w := performRequest("/cache/corrupt", r)
+	assert.Equal(t, "pong 1", w.Body.String())
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 0, evicted)
+	require.Len(t, store.data, 1)
+}
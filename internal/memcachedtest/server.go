@@ -0,0 +1,320 @@
+// Package memcachedtest provides an in-process memcached stand-in for tests,
+// which speaks the text protocol and implements the subset of commands used by the store.
+package memcachedtest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	// relativeLimit the exptime beyond 30 days is an absolute unix time.
+	relativeLimit = 60 * 60 * 24 * 30
+	// MaxItemSize the default item size limit of memcached.
+	MaxItemSize = 1024 * 1024
+)
+
+// Server an in-process memcached stand-in.
+type Server struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu     sync.Mutex
+	items  map[string]*item
+	offset time.Duration
+	conns  map[net.Conn]struct{}
+	closed bool
+}
+
+type item struct {
+	flags    uint32
+	value    []byte
+	expireAt time.Time // zero means never expires.
+}
+
+// Run starts a server which is closed when the test finishes.
+func Run(tb testing.TB) *Server {
+	tb.Helper()
+	s, err := NewServer()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// NewServer starts a server listening on a random local port.
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ln:    ln,
+		items: make(map[string]*item),
+		conns: make(map[net.Conn]struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr the address the server listens on.
+func (s *Server) Addr() string { return s.ln.Addr().String() }
+
+// Close stops the server and closes all connections.
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	for nc := range s.conns {
+		nc.Close()
+	}
+	s.mu.Unlock()
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+// FastForward moves the server clock forward, so the items expire without sleeping.
+func (s *Server) FastForward(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset += d
+}
+
+// Keys returns the sorted live keys.
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.items))
+	for k := range s.items {
+		if _, ok := s.lookup(k); ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ExpireAt returns the expiration of the item, zero means never expires.
+func (s *Server) ExpireAt(key string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, ok := s.lookup(key)
+	if !ok {
+		return time.Time{}, false
+	}
+	return it.expireAt, true
+}
+
+func (s *Server) now() time.Time { return time.Now().Add(s.offset) }
+
+func (s *Server) lookup(key string) (*item, bool) {
+	it, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	if !it.expireAt.IsZero() && !it.expireAt.After(s.now()) {
+		delete(s.items, key)
+		return nil, false
+	}
+	return it, true
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			nc.Close()
+			return
+		}
+		s.conns[nc] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(nc)
+	}
+}
+
+func (s *Server) handle(nc net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, nc)
+		s.mu.Unlock()
+		nc.Close()
+	}()
+
+	r := bufio.NewReader(nc)
+	w := bufio.NewWriter(nc)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		if !s.exec(r, w, args) {
+			return
+		}
+		if err = w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// exec runs the command, returns false if the connection must be closed.
+func (s *Server) exec(r *bufio.Reader, w *bufio.Writer, args []string) bool {
+	switch args[0] {
+	case "get", "gets":
+		s.get(w, args[1:])
+	case "set":
+		return s.set(r, w, args[1:])
+	case "delete":
+		s.delete(w, args[1:])
+	case "mg":
+		s.metaGet(w, args[1:])
+	case "flush_all":
+		s.mu.Lock()
+		s.items = make(map[string]*item)
+		s.mu.Unlock()
+		w.WriteString("OK\r\n")
+	case "stats":
+		s.stats(w)
+	case "version":
+		w.WriteString("VERSION 1.6.0-test\r\n")
+	default:
+		w.WriteString("ERROR\r\n")
+	}
+	return true
+}
+
+func (s *Server) get(w *bufio.Writer, keys []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		if it, ok := s.lookup(key); ok {
+			fmt.Fprintf(w, "VALUE %s %d %d\r\n", key, it.flags, len(it.value))
+			w.Write(it.value)
+			w.WriteString("\r\n")
+		}
+	}
+	w.WriteString("END\r\n")
+}
+
+func (s *Server) set(r *bufio.Reader, w *bufio.Writer, args []string) bool {
+	if len(args) < 4 {
+		w.WriteString("ERROR\r\n")
+		return true
+	}
+	flags, err1 := strconv.ParseUint(args[1], 10, 32)
+	exptime, err2 := strconv.ParseInt(args[2], 10, 64)
+	size, err3 := strconv.Atoi(args[3])
+	if err1 != nil || err2 != nil || err3 != nil || size < 0 {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return false
+	}
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return false
+	}
+	if string(data[size:]) != "\r\n" {
+		w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+		return false
+	}
+	if size > MaxItemSize {
+		w.WriteString("SERVER_ERROR object too large for cache\r\n")
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it := &item{flags: uint32(flags), value: data[:size]}
+	switch now := s.now(); {
+	case exptime < 0:
+		it.expireAt = now
+	case exptime == 0:
+	case exptime <= relativeLimit:
+		it.expireAt = now.Add(time.Duration(exptime) * time.Second)
+	default:
+		it.expireAt = time.Unix(exptime, 0)
+	}
+	s.items[args[0]] = it
+	w.WriteString("STORED\r\n")
+	return true
+}
+
+func (s *Server) delete(w *bufio.Writer, args []string) {
+	if len(args) < 1 {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.lookup(args[0]); !ok {
+		w.WriteString("NOT_FOUND\r\n")
+		return
+	}
+	delete(s.items, args[0])
+	w.WriteString("DELETED\r\n")
+}
+
+// metaGet serves the meta get without the value, only the t flag (remaining ttl) is supported.
+func (s *Server) metaGet(w *bufio.Writer, args []string) {
+	if len(args) < 1 {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, ok := s.lookup(args[0])
+	if !ok {
+		w.WriteString("EN\r\n")
+		return
+	}
+	w.WriteString("HD")
+	for _, flag := range args[1:] {
+		if flag == "t" {
+			ttl := int64(-1)
+			if !it.expireAt.IsZero() {
+				ttl = int64(it.expireAt.Sub(s.now()).Round(time.Second) / time.Second)
+			}
+			fmt.Fprintf(w, " t%d", ttl)
+		}
+	}
+	w.WriteString("\r\n")
+}
+
+func (s *Server) stats(w *bufio.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, size := 0, 0
+	for k := range s.items {
+		if it, ok := s.lookup(k); ok {
+			n++
+			size += len(k) + len(it.value)
+		}
+	}
+	fmt.Fprintf(w, "STAT curr_items %d\r\n", n)
+	fmt.Fprintf(w, "STAT bytes %d\r\n", size)
+	w.WriteString("END\r\n")
+}
@@ -0,0 +1,715 @@
+// Package redistest provides an in-process Redis stand-in for tests,
+// which speaks RESP2 and implements the subset of commands used by the stores.
+package redistest
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ScriptFunc the Go implementation of a Lua script, it runs atomically.
+// the reply can be nil, int64, string, []any or error.
+type ScriptFunc func(db *DB, keys, args []string) any
+
+// Server an in-process Redis stand-in.
+type Server struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu      sync.Mutex
+	db      *DB
+	offset  time.Duration
+	scripts map[string]ScriptFunc
+	subs    map[string]map[*conn]struct{}
+	conns   map[*conn]struct{}
+	slots   []any
+	closed  bool
+}
+
+// Cluster makes the servers a cluster, the hash slots are split evenly across the servers,
+// it does not redirect, the client computes the slots.
+func Cluster(servers ...*Server) {
+	const slotCount = 16384
+	slots := make([]any, 0, len(servers))
+	for i, srv := range servers {
+		host, port, _ := net.SplitHostPort(srv.Addr()) // nolint: errcheck
+		start := i * slotCount / len(servers)
+		end := (i+1)*slotCount/len(servers) - 1
+		slots = append(slots, []any{int64(start), int64(end), []any{host, port, fmt.Sprintf("node%d", i)}})
+	}
+	for _, srv := range servers {
+		srv.mu.Lock()
+		srv.slots = slots
+		srv.mu.Unlock()
+	}
+}
+
+// Run starts a server which is closed when the test finishes.
+func Run(tb testing.TB) *Server {
+	tb.Helper()
+	s, err := NewServer()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// NewServer starts a server listening on a random local port.
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ln:      ln,
+		scripts: make(map[string]ScriptFunc),
+		subs:    make(map[string]map[*conn]struct{}),
+		conns:   make(map[*conn]struct{}),
+	}
+	s.db = &DB{items: make(map[string]*item), now: s.now, cursors: make(map[int]string)}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr the address the server listens on.
+func (s *Server) Addr() string { return s.ln.Addr().String() }
+
+// Close stops the server and closes all connections.
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	for c := range s.conns {
+		c.nc.Close()
+	}
+	s.mu.Unlock()
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+// FastForward moves the server clock forward, so the keys expire without sleeping.
+func (s *Server) FastForward(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset += d
+}
+
+// RegisterScript registers the Go implementation of the Lua script,
+// which serves both EVAL and EVALSHA.
+func (s *Server) RegisterScript(script string, fn ScriptFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts[scriptSha(script)] = fn
+}
+
+// Keys returns the sorted live keys.
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.keys()
+}
+
+func (s *Server) now() time.Time { return time.Now().Add(s.offset) }
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		c := &conn{nc: nc, w: bufio.NewWriter(nc)}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			nc.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(c)
+	}
+}
+
+func (s *Server) handle(c *conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		for ch, cs := range s.subs {
+			delete(cs, c)
+			if len(cs) == 0 {
+				delete(s.subs, ch)
+			}
+		}
+		s.mu.Unlock()
+		c.nc.Close()
+	}()
+
+	r := bufio.NewReader(c.nc)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		reply := s.exec(c, strings.ToUpper(args[0]), args[1:])
+		c.mu.Lock()
+		writeReply(c.w, reply)
+		err = c.w.Flush()
+		c.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+type conn struct {
+	nc         net.Conn
+	mu         sync.Mutex
+	w          *bufio.Writer
+	subscribed int
+}
+
+// push writes an out of band reply, such as the published message.
+func (c *conn) push(reply any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeReply(c.w, reply)
+	c.w.Flush() // nolint: errcheck
+}
+
+type status string
+
+// multiReply several replies for one command, such as SUBSCRIBE with several channels.
+type multiReply []any
+
+var (
+	errSyntax      = errors.New("ERR syntax error")
+	errWrongNumber = errors.New("ERR wrong number of arguments")
+	errNotInteger  = errors.New("ERR value is not an integer or out of range")
+)
+
+// commandTable the COMMAND reply, the cluster and ring clients find the key position by it:
+// name, arity, flags, first key, last key, step.
+var commandTable = []any{
+	[]any{"get", int64(2), []any{"readonly"}, int64(1), int64(1), int64(1)},
+	[]any{"set", int64(-3), []any{"write"}, int64(1), int64(1), int64(1)},
+	[]any{"del", int64(-2), []any{"write"}, int64(1), int64(-1), int64(1)},
+	[]any{"unlink", int64(-2), []any{"write"}, int64(1), int64(-1), int64(1)},
+	[]any{"exists", int64(-2), []any{"readonly"}, int64(1), int64(-1), int64(1)},
+	[]any{"pttl", int64(2), []any{"readonly"}, int64(1), int64(1), int64(1)},
+	[]any{"ttl", int64(2), []any{"readonly"}, int64(1), int64(1), int64(1)},
+	[]any{"pexpire", int64(3), []any{"write"}, int64(1), int64(1), int64(1)},
+	[]any{"expire", int64(3), []any{"write"}, int64(1), int64(1), int64(1)},
+	[]any{"mget", int64(-2), []any{"readonly"}, int64(1), int64(-1), int64(1)},
+	[]any{"scan", int64(-2), []any{"readonly"}, int64(0), int64(0), int64(0)},
+	[]any{"dbsize", int64(1), []any{"readonly"}, int64(0), int64(0), int64(0)},
+	[]any{"flushdb", int64(-1), []any{"write"}, int64(0), int64(0), int64(0)},
+	[]any{"info", int64(-1), []any{}, int64(0), int64(0), int64(0)},
+	[]any{"publish", int64(3), []any{}, int64(0), int64(0), int64(0)},
+	[]any{"eval", int64(-3), []any{}, int64(0), int64(0), int64(0)},
+	[]any{"evalsha", int64(-3), []any{}, int64(0), int64(0), int64(0)},
+}
+
+func (s *Server) exec(c *conn, cmd string, args []string) any {
+	switch cmd {
+	case "SUBSCRIBE", "UNSUBSCRIBE":
+		return s.subscribe(c, cmd, args)
+	case "PING":
+		if c.subscribed > 0 {
+			return []any{"pong", ""}
+		}
+		if len(args) > 0 {
+			return args[0]
+		}
+		return status("PONG")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	db := s.db
+
+	switch cmd {
+	case "SELECT", "CLIENT", "READONLY":
+		return status("OK")
+	case "COMMAND":
+		return commandTable
+	case "CLUSTER":
+		if len(args) == 0 || strings.ToUpper(args[0]) != "SLOTS" || s.slots == nil {
+			return errors.New("ERR This instance has cluster support disabled")
+		}
+		return s.slots
+	case "GET":
+		if len(args) != 1 {
+			return errWrongNumber
+		}
+		if v, ok := db.Get(args[0]); ok {
+			return v
+		}
+		return nil
+	case "SET":
+		return db.set(args)
+	case "DEL", "UNLINK":
+		n := int64(0)
+		for _, k := range args {
+			if db.Del(k) {
+				n++
+			}
+		}
+		return n
+	case "EXISTS":
+		n := int64(0)
+		for _, k := range args {
+			if _, ok := db.Get(k); ok {
+				n++
+			}
+		}
+		return n
+	case "PTTL", "TTL":
+		if len(args) != 1 {
+			return errWrongNumber
+		}
+		d, ok := db.TTL(args[0])
+		switch {
+		case !ok:
+			return int64(-2)
+		case d < 0:
+			return int64(-1)
+		case cmd == "TTL":
+			return int64(d / time.Second)
+		default:
+			return int64(d / time.Millisecond)
+		}
+	case "PEXPIRE", "EXPIRE":
+		if len(args) != 2 {
+			return errWrongNumber
+		}
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errNotInteger
+		}
+		d := time.Duration(n) * time.Millisecond
+		if cmd == "EXPIRE" {
+			d = time.Duration(n) * time.Second
+		}
+		if db.Expire(args[0], d) {
+			return int64(1)
+		}
+		return int64(0)
+	case "MGET":
+		replies := make([]any, 0, len(args))
+		for _, k := range args {
+			if v, ok := db.Get(k); ok {
+				replies = append(replies, v)
+			} else {
+				replies = append(replies, nil)
+			}
+		}
+		return replies
+	case "SCAN":
+		return db.scan(args)
+	case "DBSIZE":
+		return int64(len(db.keys()))
+	case "FLUSHDB", "FLUSHALL":
+		db.items = make(map[string]*item)
+		return status("OK")
+	case "INFO":
+		size := 0
+		for k, it := range db.items {
+			size += len(k) + len(it.value)
+		}
+		return fmt.Sprintf("# Memory\r\nused_memory:%d\r\n", size)
+	case "PUBLISH":
+		if len(args) != 2 {
+			return errWrongNumber
+		}
+		n := int64(0)
+		for sc := range s.subs[args[0]] {
+			sc.push([]any{"message", args[0], args[1]})
+			n++
+		}
+		return n
+	case "EVAL", "EVALSHA":
+		if len(args) < 2 {
+			return errWrongNumber
+		}
+		sha := args[0]
+		if cmd == "EVAL" {
+			sha = scriptSha(args[0])
+		}
+		fn, ok := s.scripts[sha]
+		if !ok {
+			return errors.New("NOSCRIPT No matching script. Please use EVAL.")
+		}
+		numKeys, err := strconv.Atoi(args[1])
+		if err != nil || numKeys < 0 || numKeys > len(args)-2 {
+			return errNotInteger
+		}
+		return fn(db, args[2:2+numKeys], args[2+numKeys:])
+	default:
+		return fmt.Errorf("ERR unknown command '%s'", strings.ToLower(cmd))
+	}
+}
+
+func (s *Server) subscribe(c *conn, cmd string, channels []string) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	replies := make(multiReply, 0, len(channels))
+	for _, ch := range channels {
+		if cmd == "SUBSCRIBE" {
+			cs, ok := s.subs[ch]
+			if !ok {
+				cs = make(map[*conn]struct{})
+				s.subs[ch] = cs
+			}
+			if _, ok := cs[c]; !ok {
+				cs[c] = struct{}{}
+				c.subscribed++
+			}
+		} else if cs, ok := s.subs[ch]; ok {
+			if _, ok := cs[c]; ok {
+				delete(cs, c)
+				c.subscribed--
+			}
+		}
+		replies = append(replies, []any{strings.ToLower(cmd), ch, int64(c.subscribed)})
+	}
+	return replies
+}
+
+func scriptSha(script string) string {
+	sum := sha1.Sum([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+type item struct {
+	value    string
+	expireAt time.Time
+}
+
+// DB the key space of the server, it is only valid inside a ScriptFunc.
+type DB struct {
+	items map[string]*item
+	now   func() time.Time
+	// cursors the last key returned by the SCAN cursor.
+	cursors    map[int]string
+	nextCursor int
+}
+
+func (db *DB) lookup(key string) (*item, bool) {
+	it, ok := db.items[key]
+	if !ok {
+		return nil, false
+	}
+	if !it.expireAt.IsZero() && !db.now().Before(it.expireAt) {
+		delete(db.items, key)
+		return nil, false
+	}
+	return it, true
+}
+
+// Get returns the value of the key.
+func (db *DB) Get(key string) (string, bool) {
+	it, ok := db.lookup(key)
+	if !ok {
+		return "", false
+	}
+	return it.value, true
+}
+
+// Set sets the value of the key, ttl <= 0 means no expiration.
+func (db *DB) Set(key, value string, ttl time.Duration) {
+	it := &item{value: value}
+	if ttl > 0 {
+		it.expireAt = db.now().Add(ttl)
+	}
+	db.items[key] = it
+}
+
+// Del deletes the key, reports whether the key existed.
+func (db *DB) Del(key string) bool {
+	if _, ok := db.lookup(key); !ok {
+		return false
+	}
+	delete(db.items, key)
+	return true
+}
+
+// TTL returns the remaining time to live, negative means no expiration.
+func (db *DB) TTL(key string) (time.Duration, bool) {
+	it, ok := db.lookup(key)
+	if !ok {
+		return 0, false
+	}
+	if it.expireAt.IsZero() {
+		return -1, true
+	}
+	return it.expireAt.Sub(db.now()), true
+}
+
+// Expire sets the time to live of the key, reports whether the key exists.
+func (db *DB) Expire(key string, ttl time.Duration) bool {
+	it, ok := db.lookup(key)
+	if !ok {
+		return false
+	}
+	it.expireAt = db.now().Add(ttl)
+	return true
+}
+
+func (db *DB) keys() []string {
+	keys := make([]string, 0, len(db.items))
+	for k := range db.items {
+		if _, ok := db.lookup(k); ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (db *DB) set(args []string) any {
+	if len(args) < 2 {
+		return errWrongNumber
+	}
+	key, value := args[0], args[1]
+	var ttl time.Duration
+	var nx, xx, keepTTL bool
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return errNotInteger
+			}
+			if strings.ToUpper(args[i]) == "EX" {
+				ttl = time.Duration(n) * time.Second
+			} else {
+				ttl = time.Duration(n) * time.Millisecond
+			}
+			i++
+		default:
+			return errSyntax
+		}
+	}
+	old, exists := db.lookup(key)
+	if (nx && exists) || (xx && !exists) {
+		return nil
+	}
+	if keepTTL && exists {
+		old.value = value
+		return status("OK")
+	}
+	db.Set(key, value, ttl)
+	return status("OK")
+}
+
+func (db *DB) scan(args []string) any {
+	if len(args) < 1 {
+		return errWrongNumber
+	}
+	cursor, err := strconv.Atoi(args[0])
+	if err != nil || cursor < 0 {
+		return errors.New("ERR invalid cursor")
+	}
+	match, count := "*", 10
+	for i := 1; i+1 < len(args); i += 2 {
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			match = args[i+1]
+		case "COUNT":
+			if count, err = strconv.Atoi(args[i+1]); err != nil || count <= 0 {
+				return errNotInteger
+			}
+		default:
+			return errSyntax
+		}
+	}
+
+	keys := db.keys()
+	start := 0
+	if cursor != 0 {
+		last, ok := db.cursors[cursor]
+		if !ok {
+			return errors.New("ERR invalid cursor")
+		}
+		delete(db.cursors, cursor)
+		start = sort.SearchStrings(keys, last)
+		if start < len(keys) && keys[start] == last {
+			start++
+		}
+	}
+	end := start + count
+	if end > len(keys) {
+		end = len(keys)
+	}
+	matched := []any{}
+	for _, k := range keys[start:end] {
+		if Match(match, k) {
+			matched = append(matched, k)
+		}
+	}
+	next := 0
+	if end < len(keys) {
+		db.nextCursor++
+		next = db.nextCursor
+		db.cursors[next] = keys[end-1]
+	}
+	return []any{strconv.Itoa(next), matched}
+}
+
+// Match reports whether the key matches the Redis glob style pattern.
+func Match(pattern, key string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(key); i++ {
+				if Match(pattern, key[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(key) == 0 {
+				return false
+			}
+		case '[':
+			if len(key) == 0 {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				return false
+			}
+			class := pattern[1 : end+1]
+			negate := strings.HasPrefix(class, "^")
+			if negate {
+				class = class[1:]
+			}
+			if strings.IndexByte(class, key[0]) >= 0 == negate {
+				return false
+			}
+			pattern = pattern[end+1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(key) == 0 || key[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		key = key[1:]
+	}
+	return len(key) == 0
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		// inline command
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err = readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("redistest: unexpected %q", line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func writeReply(w *bufio.Writer, reply any) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case status:
+		w.WriteString("+" + string(v) + "\r\n")
+	case error:
+		w.WriteString("-" + v.Error() + "\r\n")
+	case int64:
+		w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case int:
+		w.WriteString(":" + strconv.Itoa(v) + "\r\n")
+	case string:
+		w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n")
+	case []any:
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, vv := range v {
+			writeReply(w, vv)
+		}
+	case multiReply:
+		for _, vv := range v {
+			writeReply(w, vv)
+		}
+	default:
+		w.WriteString(fmt.Sprintf("-ERR unsupported reply %T\r\n", v))
+	}
+}
@@ -0,0 +1,28 @@
+package redistest
+
+import (
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, key string
+		want         bool
+	}{
+		{"*", "", true},
+		{"page:*", "page:a", true},
+		{"page:*", "pag", false},
+		{"p?ge", "page", true},
+		{"p[ab]ge", "pbge", true},
+		{"p[^ab]ge", "pbge", false},
+		{`page\*`, "page*", true},
+		{`page\*`, "pagea", false},
+		{`page\[1\]*`, "page[1]x", true},
+		{"*:a", "x:y:a", true},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.key); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.key, got, tt.want)
+		}
+	}
+}
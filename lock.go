@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/things-go/gin-cache/persist"
+)
+
+// LockKeySuffix the suffix of the lock key, which is the cache key with it.
+var LockKeySuffix = ":lock"
+
+// WithLock enables the distributed lock on a miss, which deduplicates the handlers across the instances
+// sharing the store, as the single flight only deduplicates them in one process.
+// the instance acquires the lock runs the handler, the others poll the store until the response is stored,
+// and run the handler themselves if it is not stored in wait.
+// ttl is the time to live of the lock, which should be longer than the handler.
+// the store must implement persist.Locker, otherwise the lock is ignored, which is logged once.
+func WithLock(ttl, wait time.Duration) Option {
+	return func(c *Config) {
+		c.lockTTL = ttl
+		c.lockWait = wait
+	}
+}
+
+// WithLockPollInterval custom the interval to poll the store while waiting the lock, default is 50 milliseconds.
+func WithLockPollInterval(d time.Duration) Option {
+	return func(c *Config) {
+		if d > 0 {
+			c.lockPoll = d
+		}
+	}
+}
+
+// acquireLock acquires the lock of key, returns the release function if acquired,
+// or the response stored by the lock holder while waiting.
+// both are nil if the lock is disabled, fails, or the response is not stored in wait,
+// then the handler runs without the lock.
+func (cfg *Config) acquireLock(c *gin.Context, ctx context.Context, key string) (func(), *BodyCache) {
+	locker, ok := cfg.store.(persist.Locker)
+	if !ok || cfg.lockTTL <= 0 {
+		return nil, nil
+	}
+
+	ctx, endSpan := cfg.startSpan(ctx, SpanLock)
+	lockKey := key + LockKeySuffix
+	token := newLockToken()
+	acquired, err := locker.Lock(lockKey, token, cfg.lockTTL)
+	if err != nil {
+		endSpan(SpanInfo{Key: key, Err: err})
+		cfg.errorLogger.Errorf("lock cache key error: %s, cache key: %s", err, key)
+		cfg.hooks.error(c, key, err)
+		return nil, nil
+	}
+	if acquired {
+		release := func() {
+			if err := locker.Unlock(lockKey, token); err != nil {
+				cfg.errorLogger.Errorf("unlock cache key error: %s, cache key: %s", err, key)
+				cfg.hooks.error(c, key, err)
+			}
+		}
+		// the previous holder may have stored the response and released the lock
+		// between the miss and the lock.
+		bc := &BodyCache{encoding: cfg.encoding(ctx, key)}
+		if err := cfg.store.Get(key, bc); err == nil {
+			release()
+			endSpan(SpanInfo{Key: key, Hit: true, Size: len(bc.Data)})
+			return nil, bc
+		}
+		endSpan(SpanInfo{Key: key})
+		return release, nil
+	}
+
+	bc := cfg.waitLock(ctx, key)
+	if bc == nil {
+		endSpan(SpanInfo{Key: key})
+		return nil, nil
+	}
+	endSpan(SpanInfo{Key: key, Hit: true, Size: len(bc.Data)})
+	return nil, bc
+}
+
+// waitLock polls the store until the response of key is stored, returns nil if it is not stored in wait.
+func (cfg *Config) waitLock(ctx context.Context, key string) *BodyCache {
+	timer := time.NewTimer(cfg.lockWait)
+	defer timer.Stop()
+	ticker := time.NewTicker(cfg.lockPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+			return nil
+		case <-ticker.C:
+		}
+		// the response is shared with the followers of the single flight, so it is not pooled.
+		bc := &BodyCache{encoding: cfg.encoding(ctx, key)}
+		if err := cfg.store.Get(key, bc); err == nil {
+			return bc
+		}
+	}
+}
+
+// newLockToken returns a random token, which identifies the holder of the lock.
+func newLockToken() string {
+	b := make([]byte, 16)
+	rand.Read(b) // nolint: errcheck
+	return hex.EncodeToString(b)
+}
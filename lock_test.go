@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/gin-cache/persist/memory"
+)
+
+func TestCacheLock(t *testing.T) {
+	// two instances share the store, each has its own single flight.
+	store := memory.NewStore(cache.New(time.Minute, time.Minute*10))
+	var count atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	newInstance := func() *gin.Engine {
+		r := gin.New()
+		r.GET("/cache/lock", Cache(store, time.Minute, func(c *gin.Context) {
+			if count.Add(1) == 1 {
+				close(started)
+			}
+			<-release
+			c.String(http.StatusOK, "pong")
+		}, WithLock(time.Minute, 5*time.Second), WithLockPollInterval(5*time.Millisecond)))
+		return r
+	}
+	r1, r2 := newInstance(), newInstance()
+
+	var wg sync.WaitGroup
+	var w1Body, w2Body string
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		w1Body = performRequest("/cache/lock", r1).Body.String()
+	}()
+	<-started
+	go func() {
+		defer wg.Done()
+		w2Body = performRequest("/cache/lock", r2).Body.String()
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), count.Load())
+	assert.Equal(t, "pong", w1Body)
+	assert.Equal(t, "pong", w2Body)
+
+	// the lock is released after the response is stored.
+	acquired, err := store.Lock(GenerateKeyWithPrefix(PageCachePrefix, "%2Fcache%2Flock")+LockKeySuffix, "t", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+}
+
+func TestCacheLockWaitTimeout(t *testing.T) {
+	store := memory.NewStore(cache.New(time.Minute, time.Minute*10))
+	key := GenerateKeyWithPrefix(PageCachePrefix, "%2Fcache%2Flock")
+	// the lock is held by another instance which never stores the response.
+	acquired, err := store.Lock(key+LockKeySuffix, "other", time.Minute)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	count := 0
+	r := gin.New()
+	r.GET("/cache/lock", Cache(store, time.Minute, func(c *gin.Context) {
+		count++
+		c.String(http.StatusOK, "pong")
+	}, WithLock(time.Minute, 30*time.Millisecond), WithLockPollInterval(5*time.Millisecond)))
+
+	w := performRequest("/cache/lock", r)
+	assert.Equal(t, "pong", w.Body.String())
+	assert.Equal(t, 1, count)
+
+	// the response is stored by the fallback handler.
+	w = performRequest("/cache/lock", r)
+	assert.Equal(t, "pong", w.Body.String())
+	assert.Equal(t, 1, count)
+}
+
+// lockRaceStore runs beforeLock before the lock, as if the previous holder stored the response
+// and released the lock between the miss and the lock.
+type lockRaceStore struct {
+	*memory.Store
+	beforeLock func()
+}
+
+func (s *lockRaceStore) Lock(key, token string, ttl time.Duration) (bool, error) {
+	s.beforeLock()
+	return s.Store.Lock(key, token, ttl)
+}
+
+func TestCacheLockStoredBeforeLock(t *testing.T) {
+	count := 0
+	handler := func(c *gin.Context) {
+		count++
+		c.String(http.StatusOK, "pong %d", count)
+	}
+	store := &lockRaceStore{Store: memory.NewStore(cache.New(time.Minute, time.Minute*10))}
+	other := gin.New()
+	other.GET("/cache/lock", Cache(store, time.Minute, handler))
+	store.beforeLock = func() { performRequest("/cache/lock", other) }
+
+	r := gin.New()
+	r.GET("/cache/lock", Cache(store, time.Minute, handler, WithLock(time.Minute, time.Second)))
+	w := performRequest("/cache/lock", r)
+	assert.Equal(t, "pong 1", w.Body.String())
+	assert.Equal(t, 1, count)
+
+	// the lock is released.
+	acquired, err := store.Lock(GenerateKeyWithPrefix(PageCachePrefix, "%2Fcache%2Flock")+LockKeySuffix, "t", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+}
+
+func TestCacheLockUnsupported(t *testing.T) {
+	logger := &recordLogger{}
+	r := gin.New()
+	r.GET("/cache/lock", Cache(newBinaryStore(), time.Minute, func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	}, WithLock(time.Minute, time.Second), WithLogger(logger)))
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "pong", performRequest("/cache/lock", r).Body.String())
+	}
+	require.Len(t, logger.logs, 1)
+	assert.Contains(t, logger.logs[0], "persist.Locker")
+}
@@ -0,0 +1,533 @@
+// Package bitcask implements a log-structured store on the disk, the records are appended
+// to the segment files, and an in-memory key directory points to the latest record of each key.
+// the expired and overwritten records are dropped by the compaction.
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/things-go/gin-cache/persist"
+)
+
+const segmentExt = ".seg"
+
+// Store bitcask store
+type Store struct {
+	dir             string
+	maxSegmentSize  int64
+	compactInterval time.Duration
+	syncWrites      bool
+
+	mu        sync.RWMutex
+	keydir    map[string]entry
+	segments  map[uint32]*os.File
+	segSizes  map[uint32]int64
+	activeID  uint32
+	liveBytes int64
+
+	compactMu sync.Mutex
+	done      chan struct{}
+	wg        sync.WaitGroup
+	once      sync.Once
+}
+
+// entry the location of the latest record of a key.
+type entry struct {
+	seg      uint32
+	offset   int64
+	size     int64
+	expireAt int64
+}
+
+func (e entry) expired(now int64) bool {
+	return e.expireAt != 0 && e.expireAt <= now
+}
+
+// Option custom option
+type Option func(*Store)
+
+// WithMaxSegmentSize custom the maximum size of a segment file, a new segment is started beyond it,
+// default is 64MB.
+func WithMaxSegmentSize(n int64) Option {
+	return func(s *Store) {
+		if n > 0 {
+			s.maxSegmentSize = n
+		}
+	}
+}
+
+// WithCompactInterval custom the interval of the background compaction, which runs
+// when the stale records take half of the segments, default is 10 minutes.
+func WithCompactInterval(d time.Duration) Option {
+	return func(s *Store) {
+		if d > 0 {
+			s.compactInterval = d
+		}
+	}
+}
+
+// WithSync custom whether to fsync after each write, default is false,
+// the records written before a crash are kept by the os, but may be lost by a power failure.
+func WithSync(b bool) Option {
+	return func(s *Store) {
+		s.syncWrites = b
+	}
+}
+
+var _ persist.Store = (*Store)(nil)
+var _ persist.TTLer = (*Store)(nil)
+var _ persist.Exister = (*Store)(nil)
+var _ persist.PrefixDeleter = (*Store)(nil)
+var _ persist.Clearer = (*Store)(nil)
+var _ persist.Stater = (*Store)(nil)
+
+// NewStore open the bitcask store under dir, which is created if not exists.
+// the key directory is rebuilt from the segments, the records are checked by crc,
+// a segment is truncated at the first partially written or corrupt record.
+// it runs the background compaction until Close.
+func NewStore(dir string, opts ...Option) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		dir:             dir,
+		maxSegmentSize:  64 << 20,
+		compactInterval: 10 * time.Minute,
+		keydir:          make(map[string]entry),
+		segments:        make(map[uint32]*os.File),
+		segSizes:        make(map[uint32]int64),
+		done:            make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if err := s.recover(); err != nil {
+		s.closeFiles()
+		return nil, err
+	}
+	s.wg.Add(1)
+	go s.compactor()
+	return s, nil
+}
+
+// Close stops the background compaction, and closes the segment files.
+func (s *Store) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if f := s.segments[s.activeID]; f != nil {
+			err = f.Sync()
+		}
+		if cerr := s.closeFiles(); err == nil {
+			err = cerr
+		}
+	})
+	return err
+}
+
+// Set implement persist.Store interface, the value is serialized by persist.Marshal,
+// the entry never expires if expire <= 0.
+func (s *Store) Set(key string, value any, expire time.Duration) error {
+	data, err := persist.Marshal(value)
+	if err != nil {
+		return err
+	}
+	rec := &record{key: key, value: data}
+	if expire > 0 {
+		rec.expireAt = time.Now().Add(expire).UnixNano()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.put(rec)
+}
+
+// Get implement persist.Store interface
+func (s *Store) Get(key string, value any) error {
+	s.mu.RLock()
+	e, ok := s.keydir[key]
+	if !ok || e.expired(time.Now().UnixNano()) {
+		s.mu.RUnlock()
+		return persist.ErrCacheMiss
+	}
+	rec, err := readRecord(s.segments[e.seg], e.offset, e.offset+e.size)
+	s.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("bitcask: read %q: %w", key, err)
+	}
+	return persist.Unmarshal(rec.value, value)
+}
+
+// Delete implement persist.Store interface
+func (s *Store) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.remove(key)
+}
+
+// TTL implement persist.TTLer interface
+func (s *Store) TTL(key string) (time.Duration, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now()
+	e, ok := s.keydir[key]
+	if !ok || e.expired(now.UnixNano()) {
+		return 0, persist.ErrCacheMiss
+	}
+	if e.expireAt == 0 {
+		return persist.NoExpiration, nil
+	}
+	return time.Unix(0, e.expireAt).Sub(now), nil
+}
+
+// Exists implement persist.Exister interface
+func (s *Store) Exists(key string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.keydir[key]
+	return ok && !e.expired(time.Now().UnixNano()), nil
+}
+
+// DeleteByPrefix implement persist.PrefixDeleter interface
+func (s *Store) DeleteByPrefix(prefix string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	now := time.Now().UnixNano()
+	for key, e := range s.keydir {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if err := s.remove(key); err != nil {
+			return n, err
+		}
+		if !e.expired(now) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Clear implement persist.Clearer interface
+func (s *Store) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, f := range s.segments {
+		f.Close()
+		if err := os.Remove(f.Name()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		delete(s.segments, id)
+		delete(s.segSizes, id)
+	}
+	s.keydir = make(map[string]entry)
+	s.liveBytes = 0
+	// the segment id is never reused, which a running compaction may refer to.
+	return s.openSegment(s.activeID + 1)
+}
+
+// Len implement persist.Stater interface
+func (s *Store) Len() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := 0
+	now := time.Now().UnixNano()
+	for _, e := range s.keydir {
+		if !e.expired(now) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Size implement persist.Stater interface, which is the disk usage of the segments,
+// including the stale records not compacted yet.
+func (s *Store) Size() (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.totalBytes(), nil
+}
+
+// Compact rewrites the live records of the inactive segments into the active segment,
+// and removes the inactive segments, it is run by the background compaction.
+func (s *Store) Compact() error {
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	s.mu.Lock()
+	if err := s.openSegment(s.activeID + 1); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	olds := make([]uint32, 0, len(s.segments))
+	for id := range s.segments {
+		if id != s.activeID {
+			olds = append(olds, id)
+		}
+	}
+	s.mu.Unlock()
+	// ascending, so the remaining segments after a crash are never shadowed by the removed ones.
+	sort.Slice(olds, func(i, j int) bool { return olds[i] < olds[j] })
+
+	for _, id := range olds {
+		if err := s.compactSegment(id); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// the copied records are durable before the originals are removed.
+	if err := s.segments[s.activeID].Sync(); err != nil {
+		return err
+	}
+	for _, id := range olds {
+		f, ok := s.segments[id]
+		if !ok {
+			continue
+		}
+		f.Close()
+		delete(s.segments, id)
+		delete(s.segSizes, id)
+		if err := os.Remove(f.Name()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) compactSegment(id uint32) error {
+	s.mu.RLock()
+	var keys []string
+	for key, e := range s.keydir {
+		if e.seg == id {
+			keys = append(keys, key)
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, key := range keys {
+		if err := s.compactKey(id, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) compactKey(id uint32, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.keydir[key]
+	if !ok || e.seg != id {
+		// removed or overwritten meanwhile.
+		return nil
+	}
+	if e.expired(time.Now().UnixNano()) {
+		delete(s.keydir, key)
+		s.liveBytes -= e.size
+		return nil
+	}
+	rec, err := readRecord(s.segments[id], e.offset, e.offset+e.size)
+	if err != nil {
+		return fmt.Errorf("bitcask: compact %q: %w", key, err)
+	}
+	return s.put(rec)
+}
+
+func (s *Store) compactor() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.compactInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.RLock()
+			stale := s.totalBytes() - s.liveBytes
+			worth := stale > 0 && stale*2 >= s.totalBytes()
+			s.mu.RUnlock()
+			if worth {
+				s.Compact() // nolint: errcheck
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// put appends the record to the active segment and points the key to it, the lock must be held.
+func (s *Store) put(rec *record) error {
+	size := rec.size()
+	if s.segSizes[s.activeID] > 0 && s.segSizes[s.activeID]+size > s.maxSegmentSize {
+		if err := s.openSegment(s.activeID + 1); err != nil {
+			return err
+		}
+	}
+	offset, err := s.append(rec)
+	if err != nil {
+		return err
+	}
+	if old, ok := s.keydir[rec.key]; ok {
+		s.liveBytes -= old.size
+	}
+	s.keydir[rec.key] = entry{s.activeID, offset, size, rec.expireAt}
+	s.liveBytes += size
+	return nil
+}
+
+// remove appends the tombstone of the key, the lock must be held.
+func (s *Store) remove(key string) error {
+	old, ok := s.keydir[key]
+	if !ok {
+		return nil
+	}
+	if _, err := s.append(&record{key: key, flags: flagTombstone}); err != nil {
+		return err
+	}
+	delete(s.keydir, key)
+	s.liveBytes -= old.size
+	return nil
+}
+
+// append writes the record at the end of the active segment, returns the offset of the record.
+func (s *Store) append(rec *record) (int64, error) {
+	f := s.segments[s.activeID]
+	offset := s.segSizes[s.activeID]
+	if _, err := f.Write(rec.encode()); err != nil {
+		// drop the partial record, so the later records are readable.
+		f.Truncate(offset) // nolint: errcheck
+		return 0, err
+	}
+	if s.syncWrites {
+		if err := f.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	s.segSizes[s.activeID] = offset + rec.size()
+	return offset, nil
+}
+
+// openSegment starts the new active segment, the lock must be held.
+func (s *Store) openSegment(id uint32) error {
+	if f := s.segments[s.activeID]; f != nil {
+		if err := f.Sync(); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(s.segmentPath(id), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	s.segments[id] = f
+	s.segSizes[id] = 0
+	s.activeID = id
+	return nil
+}
+
+// recover rebuilds the key directory from the segments in order.
+func (s *Store) recover() error {
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	var ids []uint32
+	for _, de := range dirEntries {
+		name := de.Name()
+		if de.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 32)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint32(id))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	now := time.Now().UnixNano()
+	for _, id := range ids {
+		if err = s.loadSegment(id, now); err != nil {
+			return err
+		}
+	}
+	if len(ids) == 0 {
+		return s.openSegment(1)
+	}
+	s.activeID = ids[len(ids)-1]
+	return nil
+}
+
+func (s *Store) loadSegment(id uint32, now int64) error {
+	f, err := os.OpenFile(s.segmentPath(id), os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	s.segments[id] = f
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	size := fi.Size()
+	offset := int64(0)
+	for offset < size {
+		rec, err := readRecord(f, offset, size)
+		if err == errTruncated {
+			// a crash in the middle of the write, the rest is dropped.
+			if err = f.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if old, ok := s.keydir[rec.key]; ok {
+			delete(s.keydir, rec.key)
+			s.liveBytes -= old.size
+		}
+		e := entry{id, offset, rec.size(), rec.expireAt}
+		if rec.flags&flagTombstone == 0 && !e.expired(now) {
+			s.keydir[rec.key] = e
+			s.liveBytes += e.size
+		}
+		offset += rec.size()
+	}
+	s.segSizes[id] = offset
+	return nil
+}
+
+func (s *Store) totalBytes() int64 {
+	total := int64(0)
+	for _, size := range s.segSizes {
+		total += size
+	}
+	return total
+}
+
+func (s *Store) closeFiles() error {
+	var err error
+	for id, f := range s.segments {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		delete(s.segments, id)
+	}
+	return err
+}
+
+func (s *Store) segmentPath(id uint32) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%09d%s", id, segmentExt))
+}
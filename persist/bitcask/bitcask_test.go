@@ -0,0 +1,157 @@
+package bitcask
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/gin-cache/persist"
+	"github.com/things-go/gin-cache/persist/storetest"
+)
+
+func newBitcaskStore(t *testing.T) persist.Store {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func Test_Bitcask_Store(t *testing.T) {
+	storetest.Run(t, newBitcaskStore, storetest.WithResolution(50*time.Millisecond))
+}
+
+func Test_Bitcask_Recover(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir, WithMaxSegmentSize(256))
+	require.NoError(t, err)
+	for i := 0; i < 50; i++ {
+		require.NoError(t, store.Set(fmt.Sprintf("page:%d", i), fmt.Sprintf("v%d", i), time.Hour))
+	}
+	require.NoError(t, store.Set("page:0", "overwritten", time.Hour))
+	require.NoError(t, store.Delete("page:1"))
+	require.NoError(t, store.Set("expired", "v", time.Millisecond))
+	require.Greater(t, len(store.segments), 1)
+	require.NoError(t, store.Close())
+	time.Sleep(5 * time.Millisecond)
+
+	store, err = NewStore(dir, WithMaxSegmentSize(256))
+	require.NoError(t, err)
+	defer store.Close()
+
+	var v string
+	require.NoError(t, store.Get("page:0", &v))
+	require.Equal(t, "overwritten", v)
+	require.ErrorIs(t, store.Get("page:1", &v), persist.ErrCacheMiss)
+	require.ErrorIs(t, store.Get("expired", &v), persist.ErrCacheMiss)
+	require.NoError(t, store.Get("page:49", &v))
+	require.Equal(t, "v49", v)
+	n, err := store.Len()
+	require.NoError(t, err)
+	require.Equal(t, 49, n)
+}
+
+func Test_Bitcask_RecoverTruncated(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	require.NoError(t, err)
+	require.NoError(t, store.Set("a", "a", time.Hour))
+	require.NoError(t, store.Set("b", "b", time.Hour))
+	path := store.segmentPath(store.activeID)
+	size := store.segSizes[store.activeID]
+	require.NoError(t, store.Close())
+
+	// a crash in the middle of the write of c.
+	rec := (&record{key: "c", value: []byte("c")}).encode()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write(rec[:len(rec)-1])
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	store, err = NewStore(dir)
+	require.NoError(t, err)
+	var v string
+	require.NoError(t, store.Get("b", &v))
+	require.ErrorIs(t, store.Get("c", &v), persist.ErrCacheMiss)
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, size, fi.Size())
+
+	// the later writes are readable after the truncation.
+	require.NoError(t, store.Set("c", "c", time.Hour))
+	require.NoError(t, store.Close())
+	store, err = NewStore(dir)
+	require.NoError(t, err)
+	defer store.Close()
+	require.NoError(t, store.Get("c", &v))
+	require.Equal(t, "c", v)
+}
+
+func Test_Bitcask_RecoverCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	require.NoError(t, err)
+	require.NoError(t, store.Set("a", "a", time.Hour))
+	require.NoError(t, store.Set("b", "b", time.Hour))
+	path := store.segmentPath(store.activeID)
+	require.NoError(t, store.Close())
+
+	// flip the last byte, which is the value of b.
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	store, err = NewStore(dir)
+	require.NoError(t, err)
+	defer store.Close()
+	var v string
+	require.NoError(t, store.Get("a", &v))
+	require.Equal(t, "a", v)
+	require.ErrorIs(t, store.Get("b", &v), persist.ErrCacheMiss)
+}
+
+func Test_Bitcask_Compact(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir, WithMaxSegmentSize(1024))
+	require.NoError(t, err)
+	defer store.Close()
+
+	for round := 0; round < 10; round++ {
+		for i := 0; i < 20; i++ {
+			require.NoError(t, store.Set(fmt.Sprintf("page:%d", i), fmt.Sprintf("v%d-%d", i, round), time.Hour))
+		}
+	}
+	require.NoError(t, store.Set("expired", "v", time.Millisecond))
+	require.NoError(t, store.Delete("page:0"))
+	time.Sleep(5 * time.Millisecond)
+	before, err := store.Size()
+	require.NoError(t, err)
+
+	require.NoError(t, store.Compact())
+	after, err := store.Size()
+	require.NoError(t, err)
+	require.Less(t, after, before/5)
+	require.Equal(t, after, store.liveBytes)
+
+	var v string
+	require.ErrorIs(t, store.Get("page:0", &v), persist.ErrCacheMiss)
+	for i := 1; i < 20; i++ {
+		require.NoError(t, store.Get(fmt.Sprintf("page:%d", i), &v))
+		require.Equal(t, fmt.Sprintf("v%d-9", i), v)
+	}
+
+	// the compacted segments are recovered.
+	require.NoError(t, store.Close())
+	store, err = NewStore(dir)
+	require.NoError(t, err)
+	defer store.Close()
+	n, err := store.Len()
+	require.NoError(t, err)
+	require.Equal(t, 19, n)
+	require.NoError(t, store.Get("page:19", &v))
+	require.Equal(t, "v19-9", v)
+}
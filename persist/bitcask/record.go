@@ -0,0 +1,82 @@
+package bitcask
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// Record layout: crc(4 bytes) | expire at(8 bytes, unix nano, 0 means never expires) | flags(1 byte)
+// | key length(4 bytes) | value length(4 bytes) | key | value
+// all integers are big endian, the crc covers the bytes after itself.
+const (
+	recordHeaderSize = 21
+
+	flagTombstone = 1 << 0
+)
+
+// errTruncated the record is partially written or corrupt, which is the end of the valid records.
+var errTruncated = errors.New("bitcask: truncated record")
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+type record struct {
+	key      string
+	value    []byte
+	expireAt int64
+	flags    byte
+}
+
+func (r *record) size() int64 {
+	return int64(recordHeaderSize + len(r.key) + len(r.value))
+}
+
+func (r *record) encode() []byte {
+	buf := make([]byte, r.size())
+	binary.BigEndian.PutUint64(buf[4:12], uint64(r.expireAt))
+	buf[12] = r.flags
+	binary.BigEndian.PutUint32(buf[13:17], uint32(len(r.key)))
+	binary.BigEndian.PutUint32(buf[17:21], uint32(len(r.value)))
+	copy(buf[recordHeaderSize:], r.key)
+	copy(buf[recordHeaderSize+len(r.key):], r.value)
+	binary.BigEndian.PutUint32(buf[0:4], crc32.Checksum(buf[4:], crcTable))
+	return buf
+}
+
+// readRecord reads the record at offset which ends before limit, returns errTruncated
+// if it is partially written or the crc mismatches.
+func readRecord(r io.ReaderAt, offset, limit int64) (*record, error) {
+	if offset+recordHeaderSize > limit {
+		return nil, errTruncated
+	}
+	head := make([]byte, recordHeaderSize)
+	if _, err := r.ReadAt(head, offset); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errTruncated
+		}
+		return nil, err
+	}
+	keyLen := binary.BigEndian.Uint32(head[13:17])
+	valueLen := binary.BigEndian.Uint32(head[17:21])
+	if offset+recordHeaderSize+int64(keyLen)+int64(valueLen) > limit {
+		return nil, errTruncated
+	}
+	body := make([]byte, int64(keyLen)+int64(valueLen))
+	if _, err := r.ReadAt(body, offset+recordHeaderSize); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errTruncated
+		}
+		return nil, err
+	}
+	crc := crc32.Update(crc32.Checksum(head[4:], crcTable), crcTable, body)
+	if crc != binary.BigEndian.Uint32(head[0:4]) {
+		return nil, errTruncated
+	}
+	return &record{
+		key:      string(body[:keyLen]),
+		value:    body[keyLen:],
+		expireAt: int64(binary.BigEndian.Uint64(head[4:12])),
+		flags:    head[12],
+	}, nil
+}
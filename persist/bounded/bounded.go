@@ -0,0 +1,277 @@
+// Package bounded implements an in-process store with a maximum number of entries
+// and a maximum total bytes, the entries beyond the bounds are evicted.
+package bounded
+
+import (
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/things-go/gin-cache/persist"
+)
+
+// Policy the eviction policy.
+type Policy int
+
+const (
+	// PolicyLRU the least recently used entry is evicted.
+	PolicyLRU Policy = iota
+	// PolicyLFU the least recently used entry is evicted only if the new entry is
+	// requested more often than it (TinyLFU admission), otherwise the new entry is rejected,
+	// so a scan of the one-hit keys does not flush the hot keys.
+	PolicyLFU
+)
+
+// Store bounded memory store
+type Store struct {
+	shards    []*shard
+	mask      uint64
+	maxBytes  int64 // 0 means unlimited.
+	bytes     atomic.Int64
+	evictions atomic.Int64
+}
+
+type options struct {
+	maxEntries int
+	maxBytes   int64
+	shards     int
+	policy     Policy
+}
+
+// Option custom option
+type Option func(*options)
+
+// WithMaxEntries custom the maximum number of entries, default is 10000.
+func WithMaxEntries(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.maxEntries = n
+		}
+	}
+}
+
+// WithMaxBytes custom the maximum total bytes of the entries, default is unlimited.
+// the byte size of an entry is the key length plus persist.SizeOf the value,
+// which is the size of the body cache.
+func WithMaxBytes(n int64) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.maxBytes = n
+		}
+	}
+}
+
+// WithShards custom the number of shards, which is rounded up to a power of two, default is 16,
+// and is at most the maximum number of entries.
+// the maximum number of entries is split across the shards, the maximum total bytes is shared by them.
+func WithShards(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.shards = n
+		}
+	}
+}
+
+// WithPolicy custom the eviction policy, default is PolicyLRU.
+func WithPolicy(p Policy) Option {
+	return func(o *options) {
+		o.policy = p
+	}
+}
+
+var _ persist.Store = (*Store)(nil)
+var _ persist.TTLer = (*Store)(nil)
+var _ persist.Exister = (*Store)(nil)
+var _ persist.MultiGetter = (*Store)(nil)
+var _ persist.MultiSetter = (*Store)(nil)
+var _ persist.PrefixDeleter = (*Store)(nil)
+var _ persist.Clearer = (*Store)(nil)
+var _ persist.Stater = (*Store)(nil)
+
+// NewStore new bounded memory store
+func NewStore(opts ...Option) *Store {
+	o := options{
+		maxEntries: 10000,
+		shards:     16,
+		policy:     PolicyLRU,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	n := 1
+	for n < o.shards {
+		n <<= 1
+	}
+	// every shard holds one entry at least, so the sum of the shards is the bound.
+	for n > o.maxEntries {
+		n >>= 1
+	}
+	s := &Store{
+		shards:   make([]*shard, n),
+		mask:     uint64(n - 1),
+		maxBytes: o.maxBytes,
+	}
+	for i := range s.shards {
+		maxEntries := o.maxEntries / n
+		if i < o.maxEntries%n {
+			maxEntries++
+		}
+		s.shards[i] = newShard(maxEntries, o.maxBytes, &s.bytes, o.policy, &s.evictions)
+	}
+	return s
+}
+
+// Evictions returns the number of entries evicted to stay within the bounds,
+// the new entry rejected by the admission or beyond the bounds alone is counted too.
+func (s *Store) Evictions() int64 {
+	return s.evictions.Load()
+}
+
+// Set implement persist.Store interface, the entry never expires if expire <= 0.
+func (s *Store) Set(key string, value any, expire time.Duration) error {
+	var expireAt time.Time
+	if expire > 0 {
+		expireAt = time.Now().Add(expire)
+	}
+	sh := s.shard(key)
+	sh.set(key, value, expireAt)
+	s.shrink(sh)
+	return nil
+}
+
+// shrink evicts the least recently used entries of the other shards in turn, until the total bytes
+// is within the bound, which is exceeded if the shard of the new entry has not enough to evict.
+func (s *Store) shrink(keep *shard) {
+	for s.maxBytes > 0 && s.bytes.Load() > s.maxBytes {
+		evicted := false
+		for _, sh := range s.shards {
+			if s.bytes.Load() <= s.maxBytes {
+				return
+			}
+			if sh != keep && sh.evictOldest() {
+				evicted = true
+			}
+		}
+		if !evicted {
+			return
+		}
+	}
+}
+
+// Get implement persist.Store interface
+func (s *Store) Get(key string, value any) error {
+	val, _, found := s.shard(key).get(key, true)
+	if !found {
+		return persist.ErrCacheMiss
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Type().Kind() == reflect.Ptr && v.Elem().CanSet() {
+		v.Elem().Set(reflect.Indirect(reflect.ValueOf(val)))
+	}
+	return nil
+}
+
+// Delete implement persist.Store interface
+func (s *Store) Delete(key string) error {
+	s.shard(key).delete(key)
+	return nil
+}
+
+// TTL implement persist.TTLer interface
+func (s *Store) TTL(key string) (time.Duration, error) {
+	_, expireAt, found := s.shard(key).get(key, false)
+	if !found {
+		return 0, persist.ErrCacheMiss
+	}
+	if expireAt.IsZero() {
+		return persist.NoExpiration, nil
+	}
+	return time.Until(expireAt), nil
+}
+
+// Exists implement persist.Exister interface
+func (s *Store) Exists(key string) (bool, error) {
+	_, _, found := s.shard(key).get(key, false)
+	return found, nil
+}
+
+// GetMulti implement persist.MultiGetter interface
+func (s *Store) GetMulti(keys []string, values []any) ([]bool, error) {
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		err := s.Get(key, values[i])
+		if err != nil && err != persist.ErrCacheMiss {
+			return nil, err
+		}
+		found[i] = err == nil
+	}
+	return found, nil
+}
+
+// SetMulti implement persist.MultiSetter interface
+func (s *Store) SetMulti(items map[string]any, expire time.Duration) error {
+	for key, value := range items {
+		if err := s.Set(key, value, expire); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteByPrefix implement persist.PrefixDeleter interface
+func (s *Store) DeleteByPrefix(prefix string) (int, error) {
+	n := 0
+	for _, sh := range s.shards {
+		n += sh.deleteFunc(func(key string) bool { return strings.HasPrefix(key, prefix) })
+	}
+	return n, nil
+}
+
+// Clear implement persist.Clearer interface
+func (s *Store) Clear() error {
+	for _, sh := range s.shards {
+		sh.clear()
+	}
+	return nil
+}
+
+// Len implement persist.Stater interface
+func (s *Store) Len() (int, error) {
+	n := 0
+	for _, sh := range s.shards {
+		l, _ := sh.stat()
+		n += l
+	}
+	return n, nil
+}
+
+// Size implement persist.Stater interface, the size of the value is reported by persist.SizeOf.
+func (s *Store) Size() (int64, error) {
+	size := int64(0)
+	for _, sh := range s.shards {
+		_, b := sh.stat()
+		size += b
+	}
+	return size, nil
+}
+
+func (s *Store) shard(key string) *shard {
+	return s.shards[fnv64a(key)&s.mask]
+}
+
+// fnv64a the FNV-1a hash of the key, without allocation.
+func fnv64a(key string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= prime64
+	}
+	return h
+}
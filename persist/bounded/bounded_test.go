@@ -0,0 +1,161 @@
+package bounded
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	cache "github.com/things-go/gin-cache"
+	"github.com/things-go/gin-cache/persist"
+	"github.com/things-go/gin-cache/persist/storetest"
+)
+
+func newBoundedStore(_ *testing.T) persist.Store {
+	return NewStore()
+}
+
+func Test_Bounded_Store(t *testing.T) {
+	storetest.Run(t, newBoundedStore, storetest.WithResolution(50*time.Millisecond))
+}
+
+func Test_Bounded_MaxEntriesLRU(t *testing.T) {
+	store := NewStore(WithMaxEntries(3), WithShards(1))
+
+	var v string
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, store.Set(key, key, time.Hour))
+	}
+	// a is the most recently used now.
+	require.NoError(t, store.Get("a", &v))
+	require.NoError(t, store.Set("d", "d", time.Hour))
+
+	require.ErrorIs(t, store.Get("b", &v), persist.ErrCacheMiss)
+	for _, key := range []string{"a", "c", "d"} {
+		require.NoError(t, store.Get(key, &v))
+	}
+	require.Equal(t, int64(1), store.Evictions())
+	n, err := store.Len()
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+}
+
+func Test_Bounded_MaxBytes(t *testing.T) {
+	store := NewStore(WithMaxBytes(100), WithShards(1))
+
+	bc := &cache.BodyCache{
+		Status: http.StatusOK,
+		Header: http.Header{"Content-Type": {"text/plain"}},
+		Data:   make([]byte, 30),
+	}
+	size := int64(len("page:0") + bc.Size())
+	for i := 0; i < 5; i++ {
+		require.NoError(t, store.Set(fmt.Sprintf("page:%d", i), bc, time.Hour))
+	}
+	n, err := store.Len()
+	require.NoError(t, err)
+	require.Equal(t, int(100/size), n)
+	total, err := store.Size()
+	require.NoError(t, err)
+	require.LessOrEqual(t, total, int64(100))
+	require.Equal(t, int64(5-n), store.Evictions())
+
+	// the entry beyond the bounds alone is not stored.
+	require.NoError(t, store.Set("huge", make([]byte, 200), time.Hour))
+	exists, err := store.Exists("huge")
+	require.NoError(t, err)
+	require.False(t, exists)
+	require.Equal(t, int64(5-n+1), store.Evictions())
+}
+
+func Test_Bounded_MaxEntriesSharded(t *testing.T) {
+	store := NewStore(WithMaxEntries(10))
+
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, store.Set(fmt.Sprintf("page:%d", i), "v", time.Hour))
+	}
+	n, err := store.Len()
+	require.NoError(t, err)
+	require.Equal(t, 10, n)
+}
+
+func Test_Bounded_MaxBytesSharded(t *testing.T) {
+	store := NewStore(WithMaxBytes(1 << 20))
+
+	// an entry under the total bound is stored, though it is beyond an even split of the shards.
+	value := make([]byte, 100<<10)
+	require.NoError(t, store.Set("page:0", value, time.Hour))
+	exists, err := store.Exists("page:0")
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, int64(0), store.Evictions())
+
+	for i := 1; i < 20; i++ {
+		key := fmt.Sprintf("page:%d", i)
+		require.NoError(t, store.Set(key, value, time.Hour))
+		exists, err = store.Exists(key)
+		require.NoError(t, err)
+		require.True(t, exists)
+	}
+	total, err := store.Size()
+	require.NoError(t, err)
+	require.LessOrEqual(t, total, int64(1<<20))
+	require.Greater(t, total, int64(1<<20)-int64(len(value))*2)
+}
+
+func Test_Bounded_LFUAdmission(t *testing.T) {
+	store := NewStore(WithMaxEntries(10), WithShards(1), WithPolicy(PolicyLFU))
+
+	var v string
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("hot:%d", i)
+		require.NoError(t, store.Set(key, key, time.Hour))
+		for j := 0; j < 5; j++ {
+			require.NoError(t, store.Get(key, &v))
+		}
+	}
+	// a scan of the one-hit keys does not flush the hot keys.
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("scan:%d", i)
+		require.ErrorIs(t, store.Get(key, &v), persist.ErrCacheMiss)
+		require.NoError(t, store.Set(key, key, time.Hour))
+	}
+	for i := 0; i < 10; i++ {
+		require.NoError(t, store.Get(fmt.Sprintf("hot:%d", i), &v))
+	}
+	require.Equal(t, int64(100), store.Evictions())
+
+	// a key requested often enough is admitted.
+	for i := 0; i < 10; i++ {
+		_ = store.Get("rising", &v)
+	}
+	require.NoError(t, store.Set("rising", "rising", time.Hour))
+	require.NoError(t, store.Get("rising", &v))
+}
+
+func Test_Bounded_Concurrent(t *testing.T) {
+	store := NewStore(WithMaxEntries(64))
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			var v int
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("key:%d", (g*1000+i)%200)
+				_ = store.Set(key, i, time.Hour)
+				_ = store.Get(key, &v)
+				_ = store.Delete(fmt.Sprintf("key:%d", i%200))
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	n, err := store.Len()
+	require.NoError(t, err)
+	require.LessOrEqual(t, n, 64)
+}
@@ -0,0 +1,195 @@
+package bounded
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/things-go/gin-cache/persist"
+)
+
+// shard a bounded part of the store, the entries are kept in the recently used order.
+type shard struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64 // the bound of the total bytes of all shards, 0 means unlimited.
+	bytes      int64
+	total      *atomic.Int64 // the total bytes of all shards.
+	ll         *list.List
+	items      map[string]*list.Element
+	sketch     *sketch // nil if the policy is PolicyLRU.
+	evictions  *atomic.Int64
+}
+
+type entry struct {
+	key      string
+	value    any
+	size     int64
+	expireAt time.Time // zero means never expires.
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !e.expireAt.After(now)
+}
+
+func newShard(maxEntries int, maxBytes int64, total *atomic.Int64, policy Policy, evictions *atomic.Int64) *shard {
+	sh := &shard{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		total:      total,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+		evictions:  evictions,
+	}
+	if policy == PolicyLFU {
+		sh.sketch = newSketch(maxEntries)
+	}
+	return sh
+}
+
+// get returns the live entry, touch marks it recently used and records the access.
+func (sh *shard) get(key string, touch bool) (any, time.Time, bool) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if touch && sh.sketch != nil {
+		// the misses are recorded too, so a key requested often is admitted.
+		sh.sketch.increment(key)
+	}
+	e, ok := sh.items[key]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	ent := e.Value.(*entry)
+	if ent.expired(time.Now()) {
+		sh.removeElement(e)
+		return nil, time.Time{}, false
+	}
+	if touch {
+		sh.ll.MoveToFront(e)
+	}
+	return ent.value, ent.expireAt, true
+}
+
+func (sh *shard) set(key string, value any, expireAt time.Time) {
+	size := int64(len(key) + persist.SizeOf(value))
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.sketch != nil {
+		sh.sketch.increment(key)
+	}
+	if e, ok := sh.items[key]; ok {
+		// the old value is stale, it is removed even if the new one is not admitted.
+		sh.removeElement(e)
+	}
+	if sh.maxBytes > 0 && size > sh.maxBytes {
+		sh.evictions.Add(1)
+		return
+	}
+
+	victims := sh.victims(size)
+	if sh.sketch != nil {
+		now := time.Now()
+		freq := sh.sketch.estimate(key)
+		for _, e := range victims {
+			ent := e.Value.(*entry)
+			if !ent.expired(now) && sh.sketch.estimate(ent.key) >= freq {
+				sh.evictions.Add(1)
+				return
+			}
+		}
+	}
+	for _, e := range victims {
+		sh.removeElement(e)
+		sh.evictions.Add(1)
+	}
+
+	sh.items[key] = sh.ll.PushFront(&entry{key, value, size, expireAt})
+	sh.bytes += size
+	sh.total.Add(size)
+}
+
+// victims returns the least recently used entries of the shard which must be removed to make room
+// for size bytes, the total bytes of the other shards may still exceed the bound.
+func (sh *shard) victims(size int64) []*list.Element {
+	var victims []*list.Element
+	n, bytes := sh.ll.Len(), sh.total.Load()
+	for e := sh.ll.Back(); e != nil; e = e.Prev() {
+		if n < sh.maxEntries && (sh.maxBytes == 0 || bytes+size <= sh.maxBytes) {
+			break
+		}
+		victims = append(victims, e)
+		n--
+		bytes -= e.Value.(*entry).size
+	}
+	return victims
+}
+
+// evictOldest removes the least recently used entry, reports whether there is one.
+func (sh *shard) evictOldest() bool {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	e := sh.ll.Back()
+	if e == nil {
+		return false
+	}
+	sh.removeElement(e)
+	sh.evictions.Add(1)
+	return true
+}
+
+func (sh *shard) delete(key string) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if e, ok := sh.items[key]; ok {
+		sh.removeElement(e)
+	}
+}
+
+// deleteFunc removes the live entries whose key matches, returns the number of removed entries.
+func (sh *shard) deleteFunc(match func(key string) bool) int {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	n := 0
+	now := time.Now()
+	for key, e := range sh.items {
+		if match(key) {
+			if !e.Value.(*entry).expired(now) {
+				n++
+			}
+			sh.removeElement(e)
+		}
+	}
+	return n
+}
+
+func (sh *shard) clear() {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.ll.Init()
+	sh.items = make(map[string]*list.Element)
+	sh.total.Add(-sh.bytes)
+	sh.bytes = 0
+}
+
+// stat removes the expired entries, returns the number and the bytes of the live entries.
+func (sh *shard) stat() (int, int64) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	now := time.Now()
+	for _, e := range sh.items {
+		if e.Value.(*entry).expired(now) {
+			sh.removeElement(e)
+		}
+	}
+	return sh.ll.Len(), sh.bytes
+}
+
+func (sh *shard) removeElement(e *list.Element) {
+	ent := e.Value.(*entry)
+	sh.ll.Remove(e)
+	delete(sh.items, ent.key)
+	sh.bytes -= ent.size
+	sh.total.Add(-ent.size)
+}
@@ -0,0 +1,71 @@
+package bounded
+
+// sketch a count-min sketch which estimates the access frequency of the keys,
+// the counters are halved periodically, so the old accesses fade out.
+type sketch struct {
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+const (
+	sketchDepth = 4
+	// sketchMax the saturation of a counter.
+	sketchMax = 15
+)
+
+// newSketch new sketch for the capacity entries, the width is 4 times the capacity
+// to keep the collisions low.
+func newSketch(capacity int) *sketch {
+	width := 64
+	for width < 4*capacity {
+		width <<= 1
+	}
+	s := &sketch{
+		mask:    uint64(width - 1),
+		resetAt: 10 * width,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// index the counter index of the key in row i, by double hashing.
+func (s *sketch) index(h uint64, i int) uint64 {
+	return (h + uint64(i)*(h>>32|1)) & s.mask
+}
+
+func (s *sketch) increment(key string) {
+	h := fnv64a(key)
+	for i := range s.rows {
+		if c := &s.rows[i][s.index(h, i)]; *c < sketchMax {
+			*c++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.reset()
+	}
+}
+
+func (s *sketch) estimate(key string) uint8 {
+	h := fnv64a(key)
+	freq := uint8(sketchMax)
+	for i := range s.rows {
+		if c := s.rows[i][s.index(h, i)]; c < freq {
+			freq = c
+		}
+	}
+	return freq
+}
+
+func (s *sketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
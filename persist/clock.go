@@ -0,0 +1,15 @@
+package persist
+
+import "time"
+
+// Clock the time source, which can be replaced by a manual clock in tests,
+// so the expiration scenarios run without sleeping.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock the Clock of the system time.
+type SystemClock struct{}
+
+// Now implement Clock interface.
+func (SystemClock) Now() time.Time { return time.Now() }
@@ -0,0 +1,562 @@
+// Package file implements a store which keeps the entries as files under a directory,
+// so the entries survive restarts.
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/things-go/gin-cache/persist"
+)
+
+// Entry file layout: magic(4 bytes) | expire at(8 bytes, unix nano, big endian, 0 means never expires)
+// | key length(uvarint) | key | value
+var magic = []byte("GCF1")
+
+const (
+	headerSize = 12
+	// tempPrefix the prefix of the files being written, which are skipped by the walk.
+	tempPrefix = ".tmp-"
+	// tempMaxAge the age of the files being written beyond which Sweep removes them,
+	// which are left by a crash between the write and the rename.
+	tempMaxAge = 10 * time.Minute
+)
+
+var errCorrupt = errors.New("file: corrupt entry")
+
+// Store file store
+type Store struct {
+	dir           string
+	sweepInterval time.Duration
+	maxDiskSize   int64
+
+	done chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// Option custom option
+type Option func(*Store)
+
+// WithSweepInterval custom the interval of the background sweeper, which removes the expired entries
+// and keeps the disk usage under the cap, default is 1 minute.
+func WithSweepInterval(d time.Duration) Option {
+	return func(s *Store) {
+		if d > 0 {
+			s.sweepInterval = d
+		}
+	}
+}
+
+// WithMaxDiskSize custom the cap of the disk usage in bytes, the sweeper removes the oldest written
+// entries beyond the cap, default is unlimited.
+func WithMaxDiskSize(n int64) Option {
+	return func(s *Store) {
+		if n > 0 {
+			s.maxDiskSize = n
+		}
+	}
+}
+
+var _ persist.Store = (*Store)(nil)
+var _ persist.TTLer = (*Store)(nil)
+var _ persist.Exister = (*Store)(nil)
+var _ persist.PrefixDeleter = (*Store)(nil)
+var _ persist.Clearer = (*Store)(nil)
+var _ persist.Stater = (*Store)(nil)
+
+// NewStore new file store under dir, which is created if not exists,
+// it runs the background sweeper until Close.
+func NewStore(dir string, opts ...Option) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		dir:           dir,
+		sweepInterval: time.Minute,
+		done:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.wg.Add(1)
+	go s.sweeper()
+	return s, nil
+}
+
+// Close stops the background sweeper.
+func (s *Store) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+	})
+	return nil
+}
+
+// Set implement persist.Store interface, the value is serialized by persist.Marshal,
+// the entry never expires if expire <= 0.
+func (s *Store) Set(key string, value any, expire time.Duration) error {
+	data, err := persist.Marshal(value)
+	if err != nil {
+		return err
+	}
+	var expireAt int64
+	if expire > 0 {
+		expireAt = time.Now().Add(expire).UnixNano()
+	}
+
+	path := s.path(key)
+	dir := filepath.Dir(path)
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, tempPrefix)
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if err = writeEntry(f, key, expireAt, data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// the readers see either the old or the new entry, never a partial one.
+	if err = os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Get implement persist.Store interface
+func (s *Store) Get(key string, value any) error {
+	path := s.path(key)
+	raw, fi, err := readFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return persist.ErrCacheMiss
+		}
+		return err
+	}
+	h, data, err := parseEntry(raw)
+	if err != nil || h.key != key {
+		// a corrupt entry is dropped, which is regenerated by the caller.
+		removeIfSame(path, fi)
+		return persist.ErrCacheMiss
+	}
+	if h.expired(time.Now()) {
+		removeIfSame(path, fi)
+		return persist.ErrCacheMiss
+	}
+	return persist.Unmarshal(data, value)
+}
+
+// readFile reads the file with the info of the file read.
+func readFile(path string) ([]byte, fs.FileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, err := io.ReadAll(f)
+	return raw, fi, err
+}
+
+// removeIfSame removes the file only if it is still the file of fi,
+// so a fresh entry renamed into place by Set meanwhile is kept.
+func removeIfSame(path string, fi fs.FileInfo) error {
+	cur, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if !os.SameFile(fi, cur) {
+		return nil
+	}
+	if err = os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Delete implement persist.Store interface
+func (s *Store) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// TTL implement persist.TTLer interface
+func (s *Store) TTL(key string) (time.Duration, error) {
+	h, err := s.header(key)
+	if err != nil {
+		return 0, err
+	}
+	if h.expireAt == 0 {
+		return persist.NoExpiration, nil
+	}
+	return time.Until(time.Unix(0, h.expireAt)), nil
+}
+
+// Exists implement persist.Exister interface
+func (s *Store) Exists(key string) (bool, error) {
+	_, err := s.header(key)
+	if err == persist.ErrCacheMiss {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// DeleteByPrefix implement persist.PrefixDeleter interface
+func (s *Store) DeleteByPrefix(prefix string) (int, error) {
+	n := 0
+	now := time.Now()
+	err := s.walk(func(path string, h header, _ fs.FileInfo) error {
+		if !strings.HasPrefix(h.key, prefix) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if !h.expired(now) {
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Clear implement persist.Clearer interface, only the entry files and directories of the store
+// are removed, the others under the directory are left alone.
+func (s *Store) Clear() error {
+	return s.entryDirs(func(dir, prefix string) error {
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		for _, f := range files {
+			if !isEntryName(f.Name(), prefix) && !strings.HasPrefix(f.Name(), tempPrefix) {
+				continue
+			}
+			if err = os.Remove(filepath.Join(dir, f.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		// kept if it holds the others.
+		os.Remove(dir)
+		os.Remove(filepath.Dir(dir))
+		return nil
+	})
+}
+
+// Len implement persist.Stater interface
+func (s *Store) Len() (int, error) {
+	n := 0
+	now := time.Now()
+	err := s.walk(func(_ string, h header, _ fs.FileInfo) error {
+		if !h.expired(now) {
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Size implement persist.Stater interface, which is the disk usage of the entry files.
+func (s *Store) Size() (int64, error) {
+	size := int64(0)
+	err := s.walk(func(_ string, _ header, fi fs.FileInfo) error {
+		size += fi.Size()
+		return nil
+	})
+	return size, err
+}
+
+// Sweep removes the expired entries and the stale files being written, and then the oldest written
+// entries until the disk usage is under the cap, it is run by the background sweeper periodically.
+func (s *Store) Sweep() error {
+	type file struct {
+		path string
+		fi   fs.FileInfo
+	}
+
+	var files []file
+	total := int64(0)
+	now := time.Now()
+	if err := s.removeStaleTemps(now); err != nil {
+		return err
+	}
+	err := s.walk(func(path string, h header, fi fs.FileInfo) error {
+		if h.expired(now) {
+			return removeIfSame(path, fi)
+		}
+		files = append(files, file{path, fi})
+		total += fi.Size()
+		return nil
+	})
+	if err != nil || s.maxDiskSize == 0 || total <= s.maxDiskSize {
+		return err
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].fi.ModTime().Before(files[j].fi.ModTime()) })
+	for _, f := range files {
+		if total <= s.maxDiskSize {
+			break
+		}
+		if err = removeIfSame(f.path, f.fi); err != nil {
+			return err
+		}
+		total -= f.fi.Size()
+	}
+	return nil
+}
+
+// removeStaleTemps removes the files being written older than tempMaxAge.
+func (s *Store) removeStaleTemps(now time.Time) error {
+	return s.entryDirs(func(dir, _ string) error {
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		for _, f := range files {
+			if !f.Type().IsRegular() || !strings.HasPrefix(f.Name(), tempPrefix) {
+				continue
+			}
+			fi, err := f.Info()
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+				return err
+			}
+			if now.Sub(fi.ModTime()) < tempMaxAge {
+				continue
+			}
+			if err = os.Remove(filepath.Join(dir, f.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Store) sweeper() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Sweep() // nolint: errcheck
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// path the entry file of the key, the hashed key is split into two levels of directories,
+// so a directory does not hold too many files.
+func (s *Store) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(s.dir, name[0:2], name[2:4], name)
+}
+
+// header reads the header of the live entry of the key.
+func (s *Store) header(key string) (header, error) {
+	path := s.path(key)
+	h, err := readHeader(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, errCorrupt) {
+			return header{}, persist.ErrCacheMiss
+		}
+		return header{}, err
+	}
+	if h.key != key || h.expired(time.Now()) {
+		return header{}, persist.ErrCacheMiss
+	}
+	return h, nil
+}
+
+// walk calls fn for each entry file, the corrupt files are removed,
+// the files which do not follow the layout of the store are left alone.
+func (s *Store) walk(fn func(path string, h header, fi fs.FileInfo) error) error {
+	return s.entryDirs(func(dir, prefix string) error {
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		for _, f := range files {
+			if !f.Type().IsRegular() || !isEntryName(f.Name(), prefix) {
+				continue
+			}
+			path := filepath.Join(dir, f.Name())
+			fi, err := f.Info()
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+				return err
+			}
+			h, err := readHeader(path)
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+				if errors.Is(err, errCorrupt) {
+					removeIfSame(path, fi)
+					continue
+				}
+				return err
+			}
+			if err = fn(path, h, fi); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// entryDirs calls fn for each entry directory, which is <2 hex>/<2 hex> under the directory of the store,
+// prefix is the first 4 hex of the entry files in it.
+func (s *Store) entryDirs(fn func(dir, prefix string) error) error {
+	level1, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, d1 := range level1 {
+		if !d1.IsDir() || !isHex(d1.Name(), 2) {
+			continue
+		}
+		level2, err := os.ReadDir(filepath.Join(s.dir, d1.Name()))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		for _, d2 := range level2 {
+			if !d2.IsDir() || !isHex(d2.Name(), 2) {
+				continue
+			}
+			if err = fn(filepath.Join(s.dir, d1.Name(), d2.Name()), d1.Name()+d2.Name()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isEntryName reports whether name is the name of an entry file in the entry directory of prefix.
+func isEntryName(name, prefix string) bool {
+	return isHex(name, sha256.Size*2) && strings.HasPrefix(name, prefix)
+}
+
+// isHex reports whether s is n lowercase hex digits.
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+type header struct {
+	key      string
+	expireAt int64
+}
+
+func (h header) expired(now time.Time) bool {
+	return h.expireAt != 0 && h.expireAt <= now.UnixNano()
+}
+
+func writeEntry(w io.Writer, key string, expireAt int64, data []byte) error {
+	buf := make([]byte, 0, headerSize+binary.MaxVarintLen64+len(key))
+	buf = append(buf, magic...)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(expireAt))
+	buf = binary.AppendUvarint(buf, uint64(len(key)))
+	buf = append(buf, key...)
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func parseEntry(raw []byte) (header, []byte, error) {
+	if len(raw) < headerSize || !bytes.Equal(raw[:len(magic)], magic) {
+		return header{}, nil, errCorrupt
+	}
+	expireAt := int64(binary.BigEndian.Uint64(raw[len(magic):headerSize]))
+	keyLen, n := binary.Uvarint(raw[headerSize:])
+	if n <= 0 || keyLen > uint64(len(raw)-headerSize-n) {
+		return header{}, nil, errCorrupt
+	}
+	start := headerSize + n
+	end := start + int(keyLen)
+	return header{string(raw[start:end]), expireAt}, raw[end:], nil
+}
+
+// readHeader reads the header only, without the value.
+func readHeader(path string) (header, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return header{}, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReaderSize(f, 512)
+	head := make([]byte, headerSize)
+	if _, err = io.ReadFull(r, head); err != nil {
+		return header{}, errCorrupt
+	}
+	if !bytes.Equal(head[:len(magic)], magic) {
+		return header{}, errCorrupt
+	}
+	keyLen, err := binary.ReadUvarint(r)
+	if err != nil || keyLen > 1<<20 {
+		return header{}, errCorrupt
+	}
+	key := make([]byte, keyLen)
+	if _, err = io.ReadFull(r, key); err != nil {
+		return header{}, errCorrupt
+	}
+	return header{string(key), int64(binary.BigEndian.Uint64(head[len(magic):]))}, nil
+}
@@ -0,0 +1,179 @@
+package file
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	cache "github.com/things-go/gin-cache"
+	"github.com/things-go/gin-cache/persist"
+	"github.com/things-go/gin-cache/persist/storetest"
+)
+
+func newFileStore(t *testing.T) persist.Store {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func Test_File_Store(t *testing.T) {
+	storetest.Run(t, newFileStore, storetest.WithResolution(50*time.Millisecond))
+}
+
+func Test_File_SurviveRestart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	count := 0
+	serve := func(store persist.Store) string {
+		r := gin.New()
+		r.GET("/cache", cache.CacheWithRequestURI(store, time.Hour, func(c *gin.Context) {
+			count++
+			c.String(http.StatusOK, "hello %d", count)
+		}))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/cache", nil))
+		return w.Body.String()
+	}
+
+	store, err := NewStore(dir)
+	require.NoError(t, err)
+	require.Equal(t, "hello 1", serve(store))
+	require.NoError(t, store.Close())
+
+	store, err = NewStore(dir)
+	require.NoError(t, err)
+	defer store.Close()
+	require.Equal(t, "hello 1", serve(store))
+	require.Equal(t, 1, count)
+}
+
+func Test_File_CorruptEntry(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.Set("page", "v", time.Hour))
+	require.NoError(t, os.WriteFile(store.path("page"), []byte("garbage"), 0o644))
+
+	var v string
+	require.ErrorIs(t, store.Get("page", &v), persist.ErrCacheMiss)
+	_, err = os.Stat(store.path("page"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func Test_File_Sweep(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir, WithMaxDiskSize(1000), WithSweepInterval(time.Hour))
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.Set("expired", "v", time.Millisecond))
+	value := make([]byte, 200)
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("page:%d", i)
+		require.NoError(t, store.Set(key, value, time.Hour))
+		// the written order.
+		mt := base.Add(time.Duration(i) * time.Second)
+		require.NoError(t, os.Chtimes(store.path(key), mt, mt))
+	}
+	// the temporary files of the interrupted writes are skipped.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, tempPrefix+"1"), value, 0o644))
+	time.Sleep(5 * time.Millisecond)
+
+	require.NoError(t, store.Sweep())
+	size, err := store.Size()
+	require.NoError(t, err)
+	require.LessOrEqual(t, size, int64(1000))
+
+	exists, err := store.Exists("page:0")
+	require.NoError(t, err)
+	require.False(t, exists)
+	exists, err = store.Exists("page:9")
+	require.NoError(t, err)
+	require.True(t, exists)
+	_, err = os.Stat(store.path("expired"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func Test_File_ForeignFiles(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir, WithSweepInterval(time.Hour))
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.Set("page", "v", time.Hour))
+	entryDir := filepath.Dir(store.path("page"))
+	// the files of the others sharing the directory.
+	foreign := []string{
+		filepath.Join(dir, "README"),
+		filepath.Join(dir, "other", "data"),
+		filepath.Join(dir, "ab", "notes"),
+		filepath.Join(entryDir, "notes"),
+	}
+	for _, path := range foreign {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte("garbage"), 0o644))
+	}
+
+	n, err := store.Len()
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.NoError(t, store.Sweep())
+	require.NoError(t, store.Clear())
+
+	exists, err := store.Exists("page")
+	require.NoError(t, err)
+	require.False(t, exists)
+	for _, path := range foreign {
+		require.FileExists(t, path)
+	}
+}
+
+func Test_File_SweepStaleTemps(t *testing.T) {
+	store, err := NewStore(t.TempDir(), WithSweepInterval(time.Hour))
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.Set("page", "v", time.Hour))
+	dir := filepath.Dir(store.path("page"))
+	stale, fresh := filepath.Join(dir, tempPrefix+"1"), filepath.Join(dir, tempPrefix+"2")
+	require.NoError(t, os.WriteFile(stale, []byte("partial"), 0o644))
+	require.NoError(t, os.WriteFile(fresh, []byte("partial"), 0o644))
+	mt := time.Now().Add(-tempMaxAge - time.Minute)
+	require.NoError(t, os.Chtimes(stale, mt, mt))
+
+	require.NoError(t, store.Sweep())
+	require.NoFileExists(t, stale)
+	// may be being written.
+	require.FileExists(t, fresh)
+}
+
+func Test_File_RemoveIfSame(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "entry")
+	require.NoError(t, os.WriteFile(path, []byte("expired"), 0o644))
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+
+	// a fresh entry is renamed into place meanwhile.
+	tmp := filepath.Join(dir, tempPrefix+"1")
+	require.NoError(t, os.WriteFile(tmp, []byte("fresh"), 0o644))
+	require.NoError(t, os.Rename(tmp, path))
+	require.NoError(t, removeIfSame(path, fi))
+	require.FileExists(t, path)
+
+	fi, err = os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, removeIfSame(path, fi))
+	require.NoFileExists(t, path)
+}
@@ -0,0 +1,37 @@
+package persist
+
+import (
+	"encoding"
+	"encoding/json"
+)
+
+// Marshal serializes the value for the stores which keep bytes, it is the same as the redis store:
+// encoding.BinaryMarshaler, []byte and string are kept as is, the others are encoded as JSON.
+func Marshal(value any) ([]byte, error) {
+	switch v := value.(type) {
+	case encoding.BinaryMarshaler:
+		return v.MarshalBinary()
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	default:
+		return json.Marshal(v)
+	}
+}
+
+// Unmarshal deserializes the data serialized by Marshal into the value, which must be a pointer.
+func Unmarshal(data []byte, value any) error {
+	switch v := value.(type) {
+	case encoding.BinaryUnmarshaler:
+		return v.UnmarshalBinary(data)
+	case *[]byte:
+		*v = append([]byte(nil), data...)
+		return nil
+	case *string:
+		*v = string(data)
+		return nil
+	default:
+		return json.Unmarshal(data, v)
+	}
+}
@@ -0,0 +1,279 @@
+package memcached
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrTooLarge the item exceeds the item size limit of memcached.
+	ErrTooLarge = errors.New("memcached: item too large")
+	// ErrServer the server replies an error.
+	ErrServer = errors.New("memcached: server error")
+
+	errMiss = errors.New("memcached: cache miss")
+)
+
+// ringReplicas the number of the md5 hashes of a server on the hash ring, each hash makes 4 points,
+// which is the ketama ring.
+const ringReplicas = 40
+
+// client a small memcached text protocol client, the keys are spread across the servers
+// by consistent hashing, the connections are pooled per server.
+type client struct {
+	servers []*server
+	ring    []ringPoint
+}
+
+type ringPoint struct {
+	hash   uint32
+	server *server
+}
+
+type server struct {
+	addr    string
+	timeout time.Duration
+	idle    chan *conn
+}
+
+type conn struct {
+	nc net.Conn
+	rw *bufio.ReadWriter
+}
+
+func newClient(addrs []string, timeout time.Duration, maxIdle int) *client {
+	cl := &client{}
+	for _, addr := range addrs {
+		srv := &server{addr, timeout, make(chan *conn, maxIdle)}
+		cl.servers = append(cl.servers, srv)
+		for i := 0; i < ringReplicas; i++ {
+			sum := md5.Sum([]byte(addr + "-" + strconv.Itoa(i)))
+			for j := 0; j < 4; j++ {
+				cl.ring = append(cl.ring, ringPoint{binary.LittleEndian.Uint32(sum[j*4:]), srv})
+			}
+		}
+	}
+	sort.Slice(cl.ring, func(i, j int) bool { return cl.ring[i].hash < cl.ring[j].hash })
+	return cl
+}
+
+// pick the server of the key, the first point clockwise on the ring.
+func (cl *client) pick(key string) *server {
+	sum := md5.Sum([]byte(key))
+	h := binary.LittleEndian.Uint32(sum[:4])
+	i := sort.Search(len(cl.ring), func(i int) bool { return cl.ring[i].hash >= h })
+	if i == len(cl.ring) {
+		i = 0
+	}
+	return cl.ring[i].server
+}
+
+func (cl *client) close() {
+	for _, srv := range cl.servers {
+	drain:
+		for {
+			select {
+			case cn := <-srv.idle:
+				cn.nc.Close()
+			default:
+				break drain
+			}
+		}
+	}
+}
+
+// do runs fn on a pooled connection, the connection is dropped if fn fails,
+// as the stream may be out of sync.
+func (srv *server) do(fn func(rw *bufio.ReadWriter) error) error {
+	cn, err := srv.conn()
+	if err != nil {
+		return err
+	}
+	if srv.timeout > 0 {
+		cn.nc.SetDeadline(time.Now().Add(srv.timeout)) // nolint: errcheck
+	}
+	err = fn(cn.rw)
+	if err == nil {
+		err = cn.rw.Flush()
+	}
+	if err != nil && !errors.Is(err, errMiss) && !errors.Is(err, ErrTooLarge) {
+		cn.nc.Close()
+		return err
+	}
+	select {
+	case srv.idle <- cn:
+	default:
+		cn.nc.Close()
+	}
+	return err
+}
+
+func (srv *server) conn() (*conn, error) {
+	select {
+	case cn := <-srv.idle:
+		return cn, nil
+	default:
+	}
+	nc, err := net.DialTimeout("tcp", srv.addr, srv.timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{nc, bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc))}, nil
+}
+
+// get retrieves the values of the keys on the server, the missing keys are absent in the result.
+func (srv *server) get(keys []string) (map[string][]byte, error) {
+	values := make(map[string][]byte, len(keys))
+	err := srv.do(func(rw *bufio.ReadWriter) error {
+		fmt.Fprintf(rw, "get %s\r\n", strings.Join(keys, " "))
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+		for {
+			line, err := readLine(rw.Reader)
+			if err != nil {
+				return err
+			}
+			if line == "END" {
+				return nil
+			}
+			var key string
+			var flags uint32
+			var size int
+			if _, err = fmt.Sscanf(line, "VALUE %s %d %d", &key, &flags, &size); err != nil {
+				return fmt.Errorf("%w: unexpected reply %q", ErrServer, line)
+			}
+			data := make([]byte, size+2)
+			if _, err = io.ReadFull(rw, data); err != nil {
+				return err
+			}
+			if !bytes.HasSuffix(data, []byte("\r\n")) {
+				return fmt.Errorf("%w: corrupt value of %q", ErrServer, key)
+			}
+			values[key] = data[:size]
+		}
+	})
+	return values, err
+}
+
+func (srv *server) set(key string, value []byte, exptime int64) error {
+	return srv.do(func(rw *bufio.ReadWriter) error {
+		fmt.Fprintf(rw, "set %s 0 %d %d\r\n", key, exptime, len(value))
+		rw.Write(value)
+		rw.WriteString("\r\n")
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+		line, err := readLine(rw.Reader)
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "STORED":
+			return nil
+		case strings.Contains(line, "too large"):
+			return ErrTooLarge
+		default:
+			return replyError(line)
+		}
+	})
+}
+
+func (srv *server) delete(key string) error {
+	return srv.do(func(rw *bufio.ReadWriter) error {
+		fmt.Fprintf(rw, "delete %s\r\n", key)
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+		line, err := readLine(rw.Reader)
+		if err != nil {
+			return err
+		}
+		switch line {
+		case "DELETED":
+			return nil
+		case "NOT_FOUND":
+			return errMiss
+		default:
+			return replyError(line)
+		}
+	})
+}
+
+// ttl meta gets the key without the value, returns the remaining time to live in seconds,
+// -1 means never expires.
+func (srv *server) ttl(key string) (int64, error) {
+	var ttl int64
+	err := srv.do(func(rw *bufio.ReadWriter) error {
+		fmt.Fprintf(rw, "mg %s t\r\n", key)
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+		line, err := readLine(rw.Reader)
+		if err != nil {
+			return err
+		}
+		if line == "EN" {
+			return errMiss
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "HD" {
+			return replyError(line)
+		}
+		for _, f := range fields[1:] {
+			if strings.HasPrefix(f, "t") {
+				ttl, err = strconv.ParseInt(f[1:], 10, 64)
+				return err
+			}
+		}
+		return fmt.Errorf("%w: unexpected reply %q", ErrServer, line)
+	})
+	return ttl, err
+}
+
+func (srv *server) stats() (map[string]string, error) {
+	stats := make(map[string]string)
+	err := srv.do(func(rw *bufio.ReadWriter) error {
+		rw.WriteString("stats\r\n")
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+		for {
+			line, err := readLine(rw.Reader)
+			if err != nil {
+				return err
+			}
+			if line == "END" {
+				return nil
+			}
+			fields := strings.Fields(line)
+			if len(fields) != 3 || fields[0] != "STAT" {
+				return replyError(line)
+			}
+			stats[fields[1]] = fields[2]
+		}
+	})
+	return stats, err
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
+
+func replyError(line string) error {
+	return fmt.Errorf("%w: %s", ErrServer, line)
+}
@@ -0,0 +1,260 @@
+// Package memcached implements a memcached store on top of a small built-in text protocol client.
+package memcached
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/things-go/gin-cache/persist"
+)
+
+const (
+	// maxKeyLength the key length limit of memcached.
+	maxKeyLength = 250
+	// maxRelativeExpire memcached takes the expiration beyond 30 days as an absolute unix time.
+	maxRelativeExpire = 30 * 24 * time.Hour
+)
+
+// Store memcached store
+type Store struct {
+	client      *client
+	maxItemSize int
+}
+
+type options struct {
+	timeout     time.Duration
+	maxIdle     int
+	maxItemSize int
+}
+
+// Option custom option
+type Option func(*options)
+
+// WithTimeout custom the dial and io timeout of a command, default is 500 milliseconds.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.timeout = d
+		}
+	}
+}
+
+// WithMaxIdleConns custom the maximum idle connections per server, default is 2.
+func WithMaxIdleConns(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.maxIdle = n
+		}
+	}
+}
+
+// WithMaxItemSize custom the item size limit, which must match the -I option of the servers,
+// default is 1MB.
+func WithMaxItemSize(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.maxItemSize = n
+		}
+	}
+}
+
+var _ persist.Store = (*Store)(nil)
+var _ persist.TTLer = (*Store)(nil)
+var _ persist.Exister = (*Store)(nil)
+var _ persist.MultiGetter = (*Store)(nil)
+var _ persist.MultiSetter = (*Store)(nil)
+var _ persist.Stater = (*Store)(nil)
+
+// NewStore new memcached store, the keys are spread across the servers by consistent hashing.
+// the key which memcached does not accept, such as too long or with spaces, is hashed.
+// it does not implement persist.Clearer, since flush_all wipes the items of the others sharing the servers.
+func NewStore(addrs []string, opts ...Option) (*Store, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("memcached: no server")
+	}
+	o := options{
+		timeout:     500 * time.Millisecond,
+		maxIdle:     2,
+		maxItemSize: 1024 * 1024,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Store{
+		client:      newClient(addrs, o.timeout, o.maxIdle),
+		maxItemSize: o.maxItemSize,
+	}, nil
+}
+
+// Close closes the idle connections.
+func (s *Store) Close() error {
+	s.client.close()
+	return nil
+}
+
+// Set implement persist.Store interface, the value is serialized by persist.Marshal,
+// returns ErrTooLarge if the item exceeds the item size limit.
+// the expiration is rounded up to seconds, and the item never expires if expire <= 0.
+func (s *Store) Set(key string, value any, expire time.Duration) error {
+	data, err := persist.Marshal(value)
+	if err != nil {
+		return err
+	}
+	key = safeKey(key)
+	if len(key)+len(data) > s.maxItemSize {
+		return ErrTooLarge
+	}
+	return s.client.pick(key).set(key, data, exptime(expire))
+}
+
+// Get implement persist.Store interface
+func (s *Store) Get(key string, value any) error {
+	key = safeKey(key)
+	values, err := s.client.pick(key).get([]string{key})
+	if err != nil {
+		return err
+	}
+	data, ok := values[key]
+	if !ok {
+		return persist.ErrCacheMiss
+	}
+	return persist.Unmarshal(data, value)
+}
+
+// Delete implement persist.Store interface
+func (s *Store) Delete(key string) error {
+	key = safeKey(key)
+	err := s.client.pick(key).delete(key)
+	if err == errMiss {
+		return nil
+	}
+	return err
+}
+
+// TTL implement persist.TTLer interface, which needs the meta commands of memcached 1.6,
+// the time to live is in seconds.
+func (s *Store) TTL(key string) (time.Duration, error) {
+	key = safeKey(key)
+	ttl, err := s.client.pick(key).ttl(key)
+	if err != nil {
+		if err == errMiss {
+			return 0, persist.ErrCacheMiss
+		}
+		return 0, err
+	}
+	if ttl < 0 {
+		return persist.NoExpiration, nil
+	}
+	return time.Duration(ttl) * time.Second, nil
+}
+
+// Exists implement persist.Exister interface, which needs the meta commands of memcached 1.6.
+func (s *Store) Exists(key string) (bool, error) {
+	_, err := s.TTL(key)
+	if err == persist.ErrCacheMiss {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetMulti implement persist.MultiGetter interface, the keys of a server are retrieved by one command.
+func (s *Store) GetMulti(keys []string, values []any) ([]bool, error) {
+	safeKeys := make([]string, len(keys))
+	byServer := make(map[*server][]string)
+	for i, key := range keys {
+		safeKeys[i] = safeKey(key)
+		srv := s.client.pick(safeKeys[i])
+		byServer[srv] = append(byServer[srv], safeKeys[i])
+	}
+	items := make(map[string][]byte, len(keys))
+	for srv, ks := range byServer {
+		got, err := srv.get(ks)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range got {
+			items[k] = v
+		}
+	}
+
+	found := make([]bool, len(keys))
+	for i, key := range safeKeys {
+		data, ok := items[key]
+		if !ok {
+			continue
+		}
+		if err := persist.Unmarshal(data, values[i]); err != nil {
+			return nil, err
+		}
+		found[i] = true
+	}
+	return found, nil
+}
+
+// SetMulti implement persist.MultiSetter interface
+func (s *Store) SetMulti(items map[string]any, expire time.Duration) error {
+	for key, value := range items {
+		if err := s.Set(key, value, expire); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Len implement persist.Stater interface, which is the sum of curr_items of the servers.
+func (s *Store) Len() (int, error) {
+	n, err := s.sumStat("curr_items")
+	return int(n), err
+}
+
+// Size implement persist.Stater interface, which is the sum of bytes of the servers.
+func (s *Store) Size() (int64, error) {
+	return s.sumStat("bytes")
+}
+
+func (s *Store) sumStat(name string) (int64, error) {
+	total := int64(0)
+	for _, srv := range s.client.servers {
+		stats, err := srv.stats()
+		if err != nil {
+			return 0, err
+		}
+		n, err := strconv.ParseInt(stats[name], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// exptime the exptime of memcached, which is in seconds, the expiration beyond 30 days
+// is sent as an absolute unix time, 0 means never expires.
+func exptime(expire time.Duration) int64 {
+	if expire <= 0 {
+		return 0
+	}
+	if expire > maxRelativeExpire {
+		return time.Now().Add(expire).Unix()
+	}
+	// round up, so the item does not expire immediately.
+	return int64((expire + time.Second - 1) / time.Second)
+}
+
+// safeKey returns the key if memcached accepts it, otherwise the hashed key.
+func safeKey(key string) string {
+	valid := len(key) > 0 && len(key) <= maxKeyLength
+	for i := 0; valid && i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			valid = false
+		}
+	}
+	if valid {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
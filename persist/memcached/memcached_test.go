@@ -0,0 +1,140 @@
+package memcached
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/gin-cache/internal/memcachedtest"
+	"github.com/things-go/gin-cache/persist"
+	"github.com/things-go/gin-cache/persist/storetest"
+)
+
+func newMemcachedStore(t *testing.T) persist.Store {
+	srv1, srv2 := memcachedtest.Run(t), memcachedtest.Run(t)
+	store, err := NewStore([]string{srv1.Addr(), srv2.Addr()})
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// memcached does not support expiration times less than 1 second.
+func Test_Memcached_Store(t *testing.T) {
+	storetest.Run(t, newMemcachedStore)
+}
+
+func Test_Memcached_DeleteByPrefix(t *testing.T) {
+	// memcached can not enumerate the keys.
+	_, err := persist.DeleteByPrefix(newMemcachedStore(t), "page:")
+	require.ErrorIs(t, err, persist.ErrNotSupported)
+}
+
+func Test_Memcached_LongExpiration(t *testing.T) {
+	srv := memcachedtest.Run(t)
+	store, err := NewStore([]string{srv.Addr()})
+	require.NoError(t, err)
+	defer store.Close()
+
+	// beyond 30 days is sent as an absolute unix time, otherwise it expires immediately.
+	require.NoError(t, store.Set("long", "v", 60*24*time.Hour))
+	expireAt, ok := srv.ExpireAt("long")
+	require.True(t, ok)
+	require.WithinDuration(t, time.Now().Add(60*24*time.Hour), expireAt, 2*time.Second)
+
+	// the sub second expiration is rounded up.
+	require.NoError(t, store.Set("short", "v", 100*time.Millisecond))
+	expireAt, ok = srv.ExpireAt("short")
+	require.True(t, ok)
+	require.WithinDuration(t, time.Now().Add(time.Second), expireAt, time.Second)
+
+	srv.FastForward(2 * time.Second)
+	var v string
+	require.ErrorIs(t, store.Get("short", &v), persist.ErrCacheMiss)
+	require.NoError(t, store.Get("long", &v))
+}
+
+func Test_Memcached_TooLarge(t *testing.T) {
+	srv := memcachedtest.Run(t)
+	store, err := NewStore([]string{srv.Addr()})
+	require.NoError(t, err)
+	defer store.Close()
+
+	err = store.Set("big", make([]byte, 2*1024*1024), time.Hour)
+	require.ErrorIs(t, err, ErrTooLarge)
+
+	// the server rejects it if the limit is misconfigured, the connection is still usable.
+	store.maxItemSize = 4 * 1024 * 1024
+	err = store.Set("big", make([]byte, 2*1024*1024), time.Hour)
+	require.ErrorIs(t, err, ErrTooLarge)
+	require.NoError(t, store.Set("small", "v", time.Hour))
+}
+
+func Test_Memcached_UnsafeKey(t *testing.T) {
+	srv := memcachedtest.Run(t)
+	store, err := NewStore([]string{srv.Addr()})
+	require.NoError(t, err)
+	defer store.Close()
+
+	for _, key := range []string{strings.Repeat("k", 300), "with space", "with\nnewline"} {
+		require.NoError(t, store.Set(key, key, time.Hour))
+		var v string
+		require.NoError(t, store.Get(key, &v))
+		require.Equal(t, key, v)
+	}
+	for _, key := range srv.Keys() {
+		require.True(t, strings.HasPrefix(key, "sha256:"))
+	}
+}
+
+func Test_Memcached_ConsistentHashing(t *testing.T) {
+	srvs := []*memcachedtest.Server{memcachedtest.Run(t), memcachedtest.Run(t)}
+	store, err := NewStore([]string{srvs[0].Addr(), srvs[1].Addr()})
+	require.NoError(t, err)
+	defer store.Close()
+
+	keys := make([]string, 100)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("page:%d", i)
+		require.NoError(t, store.Set(keys[i], keys[i], time.Hour))
+	}
+	require.NotEmpty(t, srvs[0].Keys())
+	require.NotEmpty(t, srvs[1].Keys())
+
+	values := make([]any, len(keys))
+	for i := range values {
+		values[i] = new(string)
+	}
+	found, err := store.GetMulti(keys, values)
+	require.NoError(t, err)
+	for i := range keys {
+		require.True(t, found[i])
+		require.Equal(t, keys[i], *values[i].(*string))
+	}
+}
+
+func Test_Memcached_Ring(t *testing.T) {
+	addrs := []string{"10.0.0.1:11211", "10.0.0.2:11211", "10.0.0.3:11211"}
+	cl := newClient(addrs[:2], 0, 1)
+	grown := newClient(addrs, 0, 1)
+
+	counts := make(map[string]int)
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("page:%d", i)
+		addr := cl.pick(key).addr
+		counts[addr]++
+		if to := grown.pick(key).addr; to != addr {
+			// the keys only move to the new server.
+			require.Equal(t, addrs[2], to)
+			moved++
+		}
+	}
+	require.Greater(t, counts[addrs[0]], 400)
+	require.Greater(t, counts[addrs[1]], 400)
+	// adding a server moves about a third of the keys only.
+	require.Greater(t, moved, 250)
+	require.Less(t, moved, 450)
+}
@@ -2,6 +2,8 @@ package memory
 
 import (
 	"reflect"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/patrickmn/go-cache"
@@ -12,22 +14,56 @@ import (
 // Store memory store
 type Store struct {
 	Cache *cache.Cache
+	clock persist.Clock
+	// lockMu serializes Lock and Unlock.
+	lockMu sync.Mutex
+}
+
+// item the value with its expiration by the custom clock.
+type item struct {
+	value    any
+	expireAt time.Time // zero means expired by go-cache only.
+}
+
+// Option custom option
+type Option func(*Store)
+
+// WithClock custom the clock of the expiration, default is the expiration of go-cache by the wall clock.
+// with a custom clock, the item expires by the custom clock if expire > 0, go-cache still expires it by
+// the wall clock as well, so the janitor removes the items which are never looked up again,
+// expire == 0 is the default expiration of go-cache, and expire < 0 never expires, the same as without.
+func WithClock(clock persist.Clock) Option {
+	return func(s *Store) {
+		s.clock = clock
+	}
 }
 
 // NewStore new memory store
-func NewStore(c *cache.Cache) *Store {
-	return &Store{c}
+func NewStore(c *cache.Cache, opts ...Option) *Store {
+	s := &Store{Cache: c}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Set implement persist.Store interface
 func (c *Store) Set(key string, value any, expire time.Duration) error {
-	c.Cache.Set(key, value, expire)
+	if c.clock == nil {
+		c.Cache.Set(key, value, expire)
+		return nil
+	}
+	it := item{value: value}
+	if expire > 0 {
+		it.expireAt = c.clock.Now().Add(expire)
+	}
+	c.Cache.Set(key, it, expire)
 	return nil
 }
 
 // Get implement persist.Store interface
 func (c *Store) Get(key string, value any) error {
-	val, found := c.Cache.Get(key)
+	val, _, found := c.lookup(key)
 	if !found {
 		return persist.ErrCacheMiss
 	}
@@ -44,3 +80,140 @@ func (c *Store) Delete(key string) error {
 	c.Cache.Delete(key)
 	return nil
 }
+
+// lookup returns the value and its expiration, zero expiration means never expires.
+func (c *Store) lookup(key string) (any, time.Time, bool) {
+	if c.clock == nil {
+		return c.Cache.GetWithExpiration(key)
+	}
+	val, expiration, found := c.Cache.GetWithExpiration(key)
+	if !found {
+		return nil, time.Time{}, false
+	}
+	it, ok := val.(item)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	if it.expireAt.IsZero() && !expiration.IsZero() {
+		// the default expiration of go-cache, by the wall clock.
+		it.expireAt = c.clock.Now().Add(time.Until(expiration))
+	}
+	if !it.expireAt.IsZero() && !it.expireAt.After(c.clock.Now()) {
+		c.Cache.Delete(key)
+		return nil, time.Time{}, false
+	}
+	return it.value, it.expireAt, true
+}
+
+func (c *Store) now() time.Time {
+	if c.clock == nil {
+		return time.Now()
+	}
+	return c.clock.Now()
+}
+
+var _ persist.TTLer = (*Store)(nil)
+var _ persist.Exister = (*Store)(nil)
+var _ persist.MultiGetter = (*Store)(nil)
+var _ persist.MultiSetter = (*Store)(nil)
+var _ persist.PrefixDeleter = (*Store)(nil)
+var _ persist.Clearer = (*Store)(nil)
+var _ persist.Stater = (*Store)(nil)
+var _ persist.Locker = (*Store)(nil)
+
+// TTL implement persist.TTLer interface
+func (c *Store) TTL(key string) (time.Duration, error) {
+	_, expiration, found := c.lookup(key)
+	if !found {
+		return 0, persist.ErrCacheMiss
+	}
+	if expiration.IsZero() {
+		return persist.NoExpiration, nil
+	}
+	return expiration.Sub(c.now()), nil
+}
+
+// Exists implement persist.Exister interface
+func (c *Store) Exists(key string) (bool, error) {
+	_, _, found := c.lookup(key)
+	return found, nil
+}
+
+// GetMulti implement persist.MultiGetter interface
+func (c *Store) GetMulti(keys []string, values []any) ([]bool, error) {
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		err := c.Get(key, values[i])
+		if err != nil && err != persist.ErrCacheMiss {
+			return nil, err
+		}
+		found[i] = err == nil
+	}
+	return found, nil
+}
+
+// SetMulti implement persist.MultiSetter interface
+func (c *Store) SetMulti(items map[string]any, expire time.Duration) error {
+	for key, value := range items {
+		_ = c.Set(key, value, expire)
+	}
+	return nil
+}
+
+// DeleteByPrefix implement persist.PrefixDeleter interface
+func (c *Store) DeleteByPrefix(prefix string) (int, error) {
+	n := 0
+	for key := range c.Cache.Items() {
+		if strings.HasPrefix(key, prefix) {
+			if _, _, found := c.lookup(key); found {
+				n++
+			}
+			c.Cache.Delete(key)
+		}
+	}
+	return n, nil
+}
+
+// Clear implement persist.Clearer interface
+func (c *Store) Clear() error {
+	c.Cache.Flush()
+	return nil
+}
+
+// Len implement persist.Stater interface
+func (c *Store) Len() (int, error) {
+	return c.Cache.ItemCount(), nil
+}
+
+// Size implement persist.Stater interface, the size of the value is reported by persist.SizeOf.
+func (c *Store) Size() (int64, error) {
+	size := int64(0)
+	for key, it := range c.Cache.Items() {
+		value := it.Object
+		if v, ok := value.(item); ok {
+			value = v.value
+		}
+		size += int64(len(key) + persist.SizeOf(value))
+	}
+	return size, nil
+}
+
+// Lock implement persist.Locker interface, the lock is shared by the users of the store in the process.
+func (c *Store) Lock(key, token string, ttl time.Duration) (bool, error) {
+	c.lockMu.Lock()
+	defer c.lockMu.Unlock()
+	if _, _, found := c.lookup(key); found {
+		return false, nil
+	}
+	return true, c.Set(key, token, ttl)
+}
+
+// Unlock implement persist.Locker interface
+func (c *Store) Unlock(key, token string) error {
+	c.lockMu.Lock()
+	defer c.lockMu.Unlock()
+	if val, _, found := c.lookup(key); found && val == token {
+		c.Cache.Delete(key)
+	}
+	return nil
+}
@@ -7,79 +7,61 @@ import (
 	"github.com/patrickmn/go-cache"
 	"github.com/stretchr/testify/require"
 
+	"github.com/things-go/gin-cache/cachetest"
 	"github.com/things-go/gin-cache/persist"
+	"github.com/things-go/gin-cache/persist/storetest"
 )
 
-type cacheFactory func(*testing.T, time.Duration) persist.Store
-
-// Test typical cache interactions
-func typicalGetSet(t *testing.T, newCache cacheFactory) {
-	var err error
-	storeCache := newCache(t, time.Hour)
-
-	value := "foo"
-	err = storeCache.Set("value", value, time.Hour)
-	require.NoError(t, err)
+func newInMemoryStore(_ *testing.T) persist.Store {
+	return NewStore(cache.New(time.Hour, time.Minute*10))
+}
 
-	value = ""
-	err = storeCache.Get("value", &value)
-	require.NoError(t, err)
-	require.Equal(t, "foo", value)
+func newClockMemoryStore(_ *testing.T) persist.Store {
+	return NewStore(cache.New(time.Hour, time.Minute*10), WithClock(persist.SystemClock{}))
 }
 
-func expiration(t *testing.T, newCache cacheFactory) {
-	// memcached does not support expiration times less than 1 second.
-	var err error
-	storeCache := newCache(t, time.Second)
+func Test_Memory_Store(t *testing.T) {
+	storetest.Run(t, newInMemoryStore, storetest.WithResolution(50*time.Millisecond))
+}
 
-	value := 10
-	// Test Set w/ short time
-	err = storeCache.Set("int", value, time.Second)
-	require.NoError(t, err)
-	time.Sleep(2 * time.Second)
-	err = storeCache.Get("int", &value)
-	require.ErrorIs(t, err, persist.ErrCacheMiss)
+func Test_Memory_ClockStore(t *testing.T) {
+	storetest.Run(t, newClockMemoryStore, storetest.WithResolution(50*time.Millisecond))
+}
 
-	// Test Set w/ longer time.
-	err = storeCache.Set("int", value, time.Hour)
-	require.NoError(t, err)
-	time.Sleep(2 * time.Second)
-	err = storeCache.Get("int", &value)
-	require.NoError(t, err)
+func Test_Memory_ManualClock(t *testing.T) {
+	clock := cachetest.NewClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := NewStore(cache.New(time.Hour, time.Minute*10), WithClock(clock))
 
-	// Test Set w/ forever.
-	err = storeCache.Set("int", value, -1)
+	require.NoError(t, store.Set("short", "v", time.Second))
+	require.NoError(t, store.Set("forever", "v", persist.NoExpiration))
+	ttl, err := store.TTL("short")
 	require.NoError(t, err)
-	time.Sleep(2 * time.Second)
-	err = storeCache.Get("int", &value)
+	require.Equal(t, time.Second, ttl)
+
+	clock.Advance(time.Second)
+	var s string
+	require.ErrorIs(t, store.Get("short", &s), persist.ErrCacheMiss)
+	require.NoError(t, store.Get("forever", &s))
+	require.Equal(t, "v", s)
+	n, err := store.Len()
 	require.NoError(t, err)
+	require.Equal(t, 1, n)
 }
 
-func emptyCache(t *testing.T, newCache cacheFactory) {
-	var err error
-	storeCache := newCache(t, time.Hour)
+func Test_Memory_ClockJanitor(t *testing.T) {
+	clock := cachetest.NewClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := NewStore(cache.New(time.Minute, time.Millisecond*10), WithClock(clock))
 
-	err = storeCache.Get("notexist", time.Second)
-	require.Error(t, err)
-	require.ErrorIs(t, err, persist.ErrCacheMiss)
-
-	err = storeCache.Delete("notexist")
+	// the default expiration of go-cache, the same as without the clock.
+	require.NoError(t, store.Set("default", "v", 0))
+	ttl, err := store.TTL("default")
 	require.NoError(t, err)
-}
+	require.InDelta(t, time.Minute, ttl, float64(time.Second))
 
-var newInMemoryStore = func(_ *testing.T, defaultExpiration time.Duration) persist.Store {
-	return NewStore(cache.New(defaultExpiration, time.Minute*10))
-}
-
-// Test typical cache interactions
-func Test_Memory_typicalGetSet(t *testing.T) {
-	typicalGetSet(t, newInMemoryStore)
-}
-
-func Test_Memory_Expiration(t *testing.T) {
-	expiration(t, newInMemoryStore)
-}
-
-func Test_Memory_Empty(t *testing.T) {
-	emptyCache(t, newInMemoryStore)
+	// removed by the janitor, though never looked up again.
+	require.NoError(t, store.Set("short", "v", time.Millisecond*20))
+	time.Sleep(time.Millisecond * 100)
+	n, err := store.Len()
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
 }
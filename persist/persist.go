@@ -20,3 +20,157 @@ type Store interface {
 	// Delete removes an item from the Cache. Does nothing if the key is not in the Cache.
 	Delete(key string) error
 }
+
+// ErrNotSupported the store does not support the capability.
+var ErrNotSupported = errors.New("persist: not supported")
+
+// NoExpiration the time to live of the item which never expires.
+const NoExpiration time.Duration = -1
+
+// The optional capabilities of a Store, which can be detected by type assertion.
+
+// TTLer is the interface of the store which reports the remaining time to live.
+type TTLer interface {
+	// TTL returns the remaining time to live of the item, returns NoExpiration if the item never expires,
+	// returns ErrCacheMiss if the key is not in the Cache.
+	TTL(key string) (time.Duration, error)
+}
+
+// Exister is the interface of the store which reports the existence without retrieving the item.
+type Exister interface {
+	// Exists reports whether the key is in the Cache.
+	Exists(key string) (bool, error)
+}
+
+// MultiGetter is the interface of the store which retrieves several items at once.
+type MultiGetter interface {
+	// GetMulti retrieves the items of keys into values, values[i] for keys[i],
+	// found[i] reports whether keys[i] was found.
+	GetMulti(keys []string, values []any) (found []bool, err error)
+}
+
+// MultiSetter is the interface of the store which sets several items at once.
+type MultiSetter interface {
+	// SetMulti sets the items to the Cache, replacing any existing items.
+	SetMulti(items map[string]any, expire time.Duration) error
+}
+
+// PrefixDeleter is the interface of the store which removes the items by key prefix.
+type PrefixDeleter interface {
+	// DeleteByPrefix removes the items whose key has the prefix, returns the number of removed items.
+	DeleteByPrefix(prefix string) (int, error)
+}
+
+// Clearer is the interface of the store which removes all items.
+type Clearer interface {
+	// Clear removes all items from the Cache.
+	Clear() error
+}
+
+// Stater is the interface of the store which reports its statistics.
+type Stater interface {
+	// Len returns the number of items in the Cache.
+	Len() (int, error)
+	// Size returns the byte size of the items in the Cache, which may be an estimation.
+	Size() (int64, error)
+}
+
+// Locker is the interface of the store which provides a short-lived lock shared by all the clients,
+// such as the instances of a service, the lock is an item of the Cache.
+type Locker interface {
+	// Lock acquires the lock of key with the token, which is released automatically after ttl,
+	// reports false if the lock is held by another token.
+	Lock(key, token string, ttl time.Duration) (bool, error)
+	// Unlock releases the lock of key only if it is still held by the token.
+	Unlock(key, token string) error
+}
+
+// Sizer is the interface of the value which reports its byte size.
+type Sizer interface {
+	Size() int
+}
+
+// SizeOf returns the byte size of the value, which is reported by Sizer,
+// or the length of []byte and string, otherwise returns 0.
+func SizeOf(value any) int {
+	switch v := value.(type) {
+	case Sizer:
+		return v.Size()
+	case []byte:
+		return len(v)
+	case string:
+		return len(v)
+	default:
+		return 0
+	}
+}
+
+// TTL returns the remaining time to live of the item, returns ErrNotSupported
+// if the store does not implement TTLer.
+func TTL(store Store, key string) (time.Duration, error) {
+	if s, ok := store.(TTLer); ok {
+		return s.TTL(key)
+	}
+	return 0, ErrNotSupported
+}
+
+// Exists reports whether the key is in the Cache, returns ErrNotSupported
+// if the store does not implement Exister.
+func Exists(store Store, key string) (bool, error) {
+	if s, ok := store.(Exister); ok {
+		return s.Exists(key)
+	}
+	return false, ErrNotSupported
+}
+
+// GetMulti retrieves several items, which falls back to Get one by one
+// if the store does not implement MultiGetter.
+func GetMulti(store Store, keys []string, values []any) ([]bool, error) {
+	if s, ok := store.(MultiGetter); ok {
+		return s.GetMulti(keys, values)
+	}
+	if len(keys) != len(values) {
+		return nil, errors.New("persist: keys and values length mismatch")
+	}
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		err := store.Get(key, values[i])
+		if err == nil {
+			found[i] = true
+		} else if !errors.Is(err, ErrCacheMiss) {
+			return nil, err
+		}
+	}
+	return found, nil
+}
+
+// SetMulti sets several items, which falls back to Set one by one
+// if the store does not implement MultiSetter.
+func SetMulti(store Store, items map[string]any, expire time.Duration) error {
+	if s, ok := store.(MultiSetter); ok {
+		return s.SetMulti(items, expire)
+	}
+	for key, value := range items {
+		if err := store.Set(key, value, expire); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteByPrefix removes the items whose key has the prefix, returns ErrNotSupported
+// if the store does not implement PrefixDeleter.
+func DeleteByPrefix(store Store, prefix string) (int, error) {
+	if s, ok := store.(PrefixDeleter); ok {
+		return s.DeleteByPrefix(prefix)
+	}
+	return 0, ErrNotSupported
+}
+
+// Clear removes all items, returns ErrNotSupported if the store does not implement Clearer.
+func Clear(store Store) error {
+	if s, ok := store.(Clearer); ok {
+		return s.Clear()
+	}
+	return ErrNotSupported
+}
@@ -2,6 +2,10 @@ package redis
 
 import (
 	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -9,19 +13,61 @@ import (
 	"github.com/things-go/gin-cache/persist"
 )
 
+// DefaultKeyPrefix the default key prefix of the store, which is the default PageCachePrefix of the middleware.
+const DefaultKeyPrefix = "gincache.page.cache:"
+
 // Store redis store
 type Store struct {
-	Redisc *redis.Client
+	Redisc redis.UniversalClient
+	// prefix the keys of the cache, which Clear and Len are scoped to.
+	prefix string
+	// flushDB Clear flushes the whole database.
+	flushDB bool
+}
+
+// Option custom option
+type Option func(*Store)
+
+// WithKeyPrefix custom the prefix of the cache keys, which Clear and Len are scoped to,
+// so the keys of the others sharing the database are left alone, default is DefaultKeyPrefix.
+// it must match the key prefix of the middleware, such as PageCachePrefix.
+func WithKeyPrefix(prefix string) Option {
+	return func(s *Store) {
+		s.prefix = prefix
+	}
 }
 
-// NewStore new redis store
-func NewStore(client *redis.Client) *Store {
-	return &Store{client}
+// WithFlushDB Clear flushes and Len counts the whole current database of all master nodes,
+// rather than the keys with the prefix, only use it if the database is dedicated to the cache.
+func WithFlushDB() Option {
+	return func(s *Store) {
+		s.flushDB = true
+	}
+}
+
+// NewStore new redis store, client can be *redis.Client, which includes the sentinel failover client,
+// *redis.ClusterClient or *redis.Ring.
+// no command of the store spans several keys, the multi-key operations pipeline a single-key command per key,
+// which the cluster client splits by slot, so the keys need not to be in the same slot.
+func NewStore(client redis.UniversalClient, opts ...Option) *Store {
+	s := &Store{Redisc: client, prefix: DefaultKeyPrefix}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-// Set implement persist.Store interface
+// Set implement persist.Store interface, the item never expires if expire <= 0.
 func (store *Store) Set(key string, value any, expire time.Duration) error {
-	return store.Redisc.Set(context.Background(), key, value, expire).Err()
+	return store.Redisc.Set(context.Background(), key, value, redisExpiration(expire)).Err()
+}
+
+// redisExpiration the expiration of go-redis, which takes -1 as KEEPTTL rather than persist.NoExpiration.
+func redisExpiration(expire time.Duration) time.Duration {
+	if expire < 0 {
+		return 0
+	}
+	return expire
 }
 
 // Get implement persist.Store interface
@@ -40,3 +86,227 @@ func (store *Store) Get(key string, value any) error {
 func (store *Store) Delete(key string) error {
 	return store.Redisc.Del(context.Background(), key).Err()
 }
+
+var _ persist.TTLer = (*Store)(nil)
+var _ persist.Exister = (*Store)(nil)
+var _ persist.MultiGetter = (*Store)(nil)
+var _ persist.MultiSetter = (*Store)(nil)
+var _ persist.PrefixDeleter = (*Store)(nil)
+var _ persist.Clearer = (*Store)(nil)
+var _ persist.Stater = (*Store)(nil)
+var _ persist.Locker = (*Store)(nil)
+
+// scanCount the COUNT hint of SCAN, which is also the batch size of the deletion.
+const scanCount = 512
+
+// TTL implement persist.TTLer interface
+func (store *Store) TTL(key string) (time.Duration, error) {
+	d, err := store.Redisc.PTTL(context.Background(), key).Result()
+	if err != nil {
+		return 0, err
+	}
+	switch d {
+	case -2: // the key does not exist.
+		return 0, persist.ErrCacheMiss
+	case -1: // the key has no expiration.
+		return persist.NoExpiration, nil
+	}
+	return d, nil
+}
+
+// Exists implement persist.Exister interface
+func (store *Store) Exists(key string) (bool, error) {
+	n, err := store.Redisc.Exists(context.Background(), key).Result()
+	return n > 0, err
+}
+
+// GetMulti implement persist.MultiGetter interface, which pipelines GET,
+// the cluster client splits the pipeline by slot, so the keys need not to be in the same slot.
+func (store *Store) GetMulti(keys []string, values []any) ([]bool, error) {
+	ctx := context.Background()
+	cmds := make([]*redis.StringCmd, len(keys))
+	_, err := store.Redisc.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Get(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	found := make([]bool, len(keys))
+	for i, cmd := range cmds {
+		err = cmd.Scan(values[i])
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found[i] = true
+	}
+	return found, nil
+}
+
+// SetMulti implement persist.MultiSetter interface, which pipelines SET,
+// the cluster client splits the pipeline by slot, so the keys need not to be in the same slot.
+func (store *Store) SetMulti(items map[string]any, expire time.Duration) error {
+	ctx := context.Background()
+	_, err := store.Redisc.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, value := range items {
+			pipe.Set(ctx, key, value, redisExpiration(expire))
+		}
+		return nil
+	})
+	return err
+}
+
+// DeleteByPrefix implement persist.PrefixDeleter interface, which iterates the keys with SCAN
+// across all master nodes, and deletes the keys with a pipeline per batch.
+func (store *Store) DeleteByPrefix(prefix string) (int, error) {
+	var n atomic.Int64
+	err := store.scanPrefix(prefix, func(ctx context.Context, node redis.Cmdable, keys []string) error {
+		// single-key commands, the keys need not to be in the same slot.
+		cmds, err := node.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range keys {
+				pipe.Del(ctx, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, cmd := range cmds {
+			n.Add(cmd.(*redis.IntCmd).Val())
+		}
+		return nil
+	})
+	return int(n.Load()), err
+}
+
+// Clear implement persist.Clearer interface, which deletes the keys with the prefix,
+// or flushes the current database of all master nodes with WithFlushDB.
+func (store *Store) Clear() error {
+	if !store.flushDB {
+		_, err := store.DeleteByPrefix(store.prefix)
+		return err
+	}
+	return store.forEachNode(context.Background(), func(ctx context.Context, node redis.Cmdable) error {
+		return node.FlushDB(ctx).Err()
+	})
+}
+
+// Len implement persist.Stater interface, the number of the keys with the prefix,
+// or the number of keys in the current database of all master nodes with WithFlushDB.
+func (store *Store) Len() (int, error) {
+	var n atomic.Int64
+	if !store.flushDB {
+		err := store.scanPrefix(store.prefix, func(_ context.Context, _ redis.Cmdable, keys []string) error {
+			n.Add(int64(len(keys)))
+			return nil
+		})
+		return int(n.Load()), err
+	}
+	err := store.forEachNode(context.Background(), func(ctx context.Context, node redis.Cmdable) error {
+		size, err := node.DBSize(ctx).Result()
+		n.Add(size)
+		return err
+	})
+	return int(n.Load()), err
+}
+
+// Size implement persist.Stater interface, the used memory reported by all master nodes,
+// which includes the keys out of the prefix.
+func (store *Store) Size() (int64, error) {
+	var n atomic.Int64
+	err := store.forEachNode(context.Background(), func(ctx context.Context, node redis.Cmdable) error {
+		info, err := node.Info(ctx, "memory").Result()
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(info, "\r\n") {
+			if v, ok := strings.CutPrefix(line, "used_memory:"); ok {
+				size, err := strconv.ParseInt(v, 10, 64)
+				n.Add(size)
+				return err
+			}
+		}
+		return errors.New("persist/redis: used_memory not found")
+	})
+	return n.Load(), err
+}
+
+// unlockSource the script releases the lock only if it is still held by the token,
+// so a lock expired and acquired by another one is never released.
+const unlockSource = `if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`
+
+var unlockScript = redis.NewScript(unlockSource)
+
+// Lock implement persist.Locker interface, which is SET key token NX PX ttl.
+func (store *Store) Lock(key, token string, ttl time.Duration) (bool, error) {
+	return store.Redisc.SetNX(context.Background(), key, token, ttl).Result()
+}
+
+// Unlock implement persist.Locker interface, which compares the token and deletes the key atomically by a script.
+func (store *Store) Unlock(key, token string) error {
+	return unlockScript.Run(context.Background(), store.Redisc, []string{key}, token).Err()
+}
+
+// scanPrefix iterates the keys with the prefix by SCAN across all master nodes,
+// calls fn with the node per batch of the keys.
+func (store *Store) scanPrefix(prefix string, fn func(ctx context.Context, node redis.Cmdable, keys []string) error) error {
+	return store.forEachNode(context.Background(), func(ctx context.Context, node redis.Cmdable) error {
+		iter := node.Scan(ctx, 0, escapeGlob(prefix)+"*", scanCount).Iterator()
+		batch := make([]string, 0, scanCount)
+		for iter.Next(ctx) {
+			batch = append(batch, iter.Val())
+			if len(batch) == scanCount {
+				if err := fn(ctx, node, batch); err != nil {
+					return err
+				}
+				batch = batch[:0]
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		return fn(ctx, node, batch)
+	})
+}
+
+// forEachNode calls fn for each master node of the cluster or each shard of the ring,
+// concurrently, otherwise calls fn with the client.
+func (store *Store) forEachNode(ctx context.Context, fn func(ctx context.Context, node redis.Cmdable) error) error {
+	switch c := store.Redisc.(type) {
+	case *redis.ClusterClient:
+		return c.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return fn(ctx, node)
+		})
+	case *redis.Ring:
+		return c.ForEachShard(ctx, func(ctx context.Context, node *redis.Client) error {
+			return fn(ctx, node)
+		})
+	default:
+		return fn(ctx, c)
+	}
+}
+
+// escapeGlob escapes the glob special characters of the pattern.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -1,6 +1,8 @@
 package redis
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"testing"
 	"time"
@@ -8,90 +10,155 @@ import (
 	"github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/require"
 
+	"github.com/things-go/gin-cache/internal/redistest"
 	"github.com/things-go/gin-cache/persist"
+	"github.com/things-go/gin-cache/persist/storetest"
 )
 
-type cacheFactory func(*testing.T, time.Duration) persist.Store
+// testPrefix the keys of the suite, so the suite leaves the others in the database alone.
+const testPrefix = "gincache.storetest:"
 
-// Test typical cache interactions
-func typicalGetSet(t *testing.T, newCache cacheFactory) {
-	var err error
-	storeCache := newCache(t, time.Hour)
+func newInRedisStore(t *testing.T) persist.Store {
+	redisHost := os.Getenv("REDIS_HOST")
+	if redisHost == "" {
+		redisHost = "localhost"
+	}
+	port := os.Getenv("REDIS_PORT")
+	if port == "" {
+		port = "6379"
+	}
+	store := NewStore(redis.NewClient(&redis.Options{
+		Addr: redisHost + ":" + port,
+	}), WithKeyPrefix(testPrefix))
+	require.NoError(t, store.Clear())
+	return store
+}
 
-	value := "foo"
-	err = storeCache.Set("value", value, time.Hour)
-	require.NoError(t, err)
+func Test_Redis_Store(t *testing.T) {
+	storetest.Run(t, newInRedisStore,
+		storetest.WithResolution(50*time.Millisecond), storetest.WithKeyPrefix(testPrefix))
+}
 
-	value = ""
-	err = storeCache.Get("value", &value)
-	require.NoError(t, err)
-	require.Equal(t, "foo", value)
+// runFakeServer runs a fake server with the scripts of the store.
+func runFakeServer(t *testing.T) *redistest.Server {
+	srv := redistest.Run(t)
+	srv.RegisterScript(unlockSource, func(db *redistest.DB, keys, args []string) any {
+		if v, ok := db.Get(keys[0]); ok && v == args[0] {
+			db.Del(keys[0])
+			return int64(1)
+		}
+		return int64(0)
+	})
+	return srv
 }
 
-func expiration(t *testing.T, newCache cacheFactory) {
-	// memcached does not support expiration times less than 1 second.
-	var err error
-	storeCache := newCache(t, time.Second)
+func newFakeRedisStore(t *testing.T) persist.Store {
+	srv := runFakeServer(t)
+	return NewStore(redis.NewClient(&redis.Options{Addr: srv.Addr()}), WithKeyPrefix(testPrefix))
+}
 
-	value := 10
+func Test_Redis_FakeStore(t *testing.T) {
+	storetest.Run(t, newFakeRedisStore,
+		storetest.WithResolution(50*time.Millisecond), storetest.WithKeyPrefix(testPrefix))
+}
 
-	// Test Set w/ short time
-	err = storeCache.Set("int", value, time.Second)
-	require.NoError(t, err)
-	time.Sleep(2 * time.Second)
-	err = storeCache.Get("int", &value)
-	require.ErrorIs(t, err, persist.ErrCacheMiss)
+func Test_Redis_DeleteByPrefixGlob(t *testing.T) {
+	srv := runFakeServer(t)
+	storeCache := NewStore(redis.NewClient(&redis.Options{Addr: srv.Addr()}), WithKeyPrefix(""))
+
+	for _, key := range []string{"page[1]*", "page[1]*a", "page1", "page[2]"} {
+		require.NoError(t, storeCache.Set(key, "v", time.Hour))
+	}
+	for i := 0; i < scanCount+10; i++ {
+		require.NoError(t, storeCache.Set(fmt.Sprintf("batch:%d", i), "v", time.Hour))
+	}
 
-	// Test Set w/ longer time.
-	err = storeCache.Set("int", value, time.Hour)
+	deleted, err := persist.DeleteByPrefix(storeCache, "page[1]*")
 	require.NoError(t, err)
-	time.Sleep(2 * time.Second)
-	err = storeCache.Get("int", &value)
+	require.Equal(t, 2, deleted)
+	deleted, err = persist.DeleteByPrefix(storeCache, "batch:")
 	require.NoError(t, err)
+	require.Equal(t, scanCount+10, deleted)
 
-	// Test Set w/ forever.
-	err = storeCache.Set("int", value, -1)
-	require.NoError(t, err)
-	time.Sleep(2 * time.Second)
-	err = storeCache.Get("int", &value)
+	n, err := storeCache.Len()
 	require.NoError(t, err)
+	require.Equal(t, 2, n)
 }
 
-func emptyCache(t *testing.T, newCache cacheFactory) {
-	var err error
-	storeCache := newCache(t, time.Hour)
-
-	err = storeCache.Get("notexist", time.Hour)
-	require.Error(t, err)
-	require.ErrorIs(t, err, persist.ErrCacheMiss)
+func newFakeClusterStore(t *testing.T) persist.Store {
+	srv1, srv2 := runFakeServer(t), runFakeServer(t)
+	redistest.Cluster(srv1, srv2)
+	client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{srv1.Addr()}})
+	t.Cleanup(func() { client.Close() })
+	return NewStore(client, WithKeyPrefix(testPrefix))
+}
 
-	err = storeCache.Delete("notexist")
-	require.NoError(t, err)
+func newFakeRingStore(t *testing.T) persist.Store {
+	srv1, srv2 := runFakeServer(t), runFakeServer(t)
+	client := redis.NewRing(&redis.RingOptions{Addrs: map[string]string{
+		"shard1": srv1.Addr(),
+		"shard2": srv2.Addr(),
+	}})
+	t.Cleanup(func() { client.Close() })
+	return NewStore(client, WithKeyPrefix(testPrefix))
 }
 
-var newInRedisStore = func(_ *testing.T, defaultExpiration time.Duration) persist.Store {
-	redisHost := os.Getenv("REDIS_HOST")
-	if redisHost == "" {
-		redisHost = "localhost"
-	}
-	port := os.Getenv("REDIS_PORT")
-	if port == "" {
-		port = "6379"
-	}
-	return NewStore(redis.NewClient(&redis.Options{
-		Addr: redisHost + ":" + port,
-	}))
+func Test_Redis_Cluster(t *testing.T) {
+	storetest.Run(t, newFakeClusterStore,
+		storetest.WithResolution(50*time.Millisecond), storetest.WithKeyPrefix(testPrefix))
 }
 
-// Test typical cache interactions
-func Test_Memory_typicalGetSet(t *testing.T) {
-	typicalGetSet(t, newInRedisStore)
+func Test_Redis_Ring(t *testing.T) {
+	storetest.Run(t, newFakeRingStore,
+		storetest.WithResolution(50*time.Millisecond), storetest.WithKeyPrefix(testPrefix))
 }
 
-func Test_Memory_Expiration(t *testing.T) {
-	expiration(t, newInRedisStore)
+func Test_Redis_ClearScoped(t *testing.T) {
+	srv := runFakeServer(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+	// the keys of the others sharing the database.
+	require.NoError(t, client.Set(ctx, "other-team:a", "v", 0).Err())
+
+	store := NewStore(client)
+	require.NoError(t, store.Set(DefaultKeyPrefix+"a", "v", time.Hour))
+	require.NoError(t, store.Set(DefaultKeyPrefix+"b", "v", time.Hour))
+	n, err := store.Len()
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.NoError(t, store.Clear())
+	require.Equal(t, []string{"other-team:a"}, srv.Keys())
+
+	// the dedicated database is flushed with the opt-in.
+	store = NewStore(client, WithFlushDB())
+	require.NoError(t, store.Set(DefaultKeyPrefix+"a", "v", time.Hour))
+	n, err = store.Len()
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.NoError(t, store.Clear())
+	require.Empty(t, srv.Keys())
 }
 
-func Test_Memory_Empty(t *testing.T) {
-	emptyCache(t, newInRedisStore)
+func Test_Redis_ClusterDeleteByPrefix(t *testing.T) {
+	srv1, srv2 := redistest.Run(t), redistest.Run(t)
+	redistest.Cluster(srv1, srv2)
+	client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{srv1.Addr()}})
+	defer client.Close()
+	storeCache := NewStore(client)
+
+	items := make(map[string]any)
+	for i := 0; i < 100; i++ {
+		items[fmt.Sprintf("page:%d", i)] = "v"
+	}
+	require.NoError(t, storeCache.SetMulti(items, time.Hour))
+	// the keys are spread across both masters.
+	require.NotEmpty(t, srv1.Keys())
+	require.NotEmpty(t, srv2.Keys())
+
+	deleted, err := storeCache.DeleteByPrefix("page:")
+	require.NoError(t, err)
+	require.Equal(t, 100, deleted)
+	require.Empty(t, srv1.Keys())
+	require.Empty(t, srv2.Keys())
 }
@@ -0,0 +1,339 @@
+// Package storetest provides a conformance test suite for persist.Store implementations.
+//
+//	func TestStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) persist.Store {
+//			return mystore.NewStore()
+//		})
+//	}
+//
+// the optional capabilities are tested if the store implements them,
+// the store must be dedicated to the test, as the suite clears it, or be scoped to the keys
+// with the prefix of WithKeyPrefix.
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	cache "github.com/things-go/gin-cache"
+	"github.com/things-go/gin-cache/persist"
+)
+
+// Factory returns a new empty store for a test.
+type Factory func(t *testing.T) persist.Store
+
+type config struct {
+	resolution time.Duration
+	prefix     string
+}
+
+// key returns the key of the suite.
+func (c *config) key(k string) string { return c.prefix + k }
+
+// Option custom option
+type Option func(*config)
+
+// WithResolution custom the expiration resolution of the store, the expiration is tested
+// with a time to live of it, and waits twice of it, default is 1 second.
+func WithResolution(d time.Duration) Option {
+	return func(c *config) {
+		if d > 0 {
+			c.resolution = d
+		}
+	}
+}
+
+// WithKeyPrefix custom the prefix of the keys used by the suite, so a store which scopes
+// Clear and Stater to a key prefix can be tested against a shared backend, default is empty.
+func WithKeyPrefix(prefix string) Option {
+	return func(c *config) {
+		c.prefix = prefix
+	}
+}
+
+// Run runs the conformance test suite against the stores created by newStore.
+func Run(t *testing.T, newStore Factory, opts ...Option) {
+	cfg := config{resolution: time.Second}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	t.Run("GetSet", func(t *testing.T) { testGetSet(t, newStore(t), &cfg) })
+	t.Run("Miss", func(t *testing.T) { testMiss(t, newStore(t), &cfg) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, newStore(t), &cfg) })
+	t.Run("Overwrite", func(t *testing.T) { testOverwrite(t, newStore(t), &cfg) })
+	t.Run("Expiration", func(t *testing.T) { testExpiration(t, newStore(t), &cfg) })
+	t.Run("Concurrent", func(t *testing.T) { testConcurrent(t, newStore(t), &cfg) })
+	t.Run("BodyCache", func(t *testing.T) { testBodyCache(t, newStore) })
+	t.Run("Capabilities", func(t *testing.T) { testCapabilities(t, newStore(t), &cfg) })
+	t.Run("Lock", func(t *testing.T) { testLock(t, newStore(t), &cfg) })
+}
+
+func testGetSet(t *testing.T, store persist.Store, cfg *config) {
+	require.NoError(t, store.Set(cfg.key("string"), "foo", time.Hour))
+	var s string
+	require.NoError(t, store.Get(cfg.key("string"), &s))
+	require.Equal(t, "foo", s)
+
+	require.NoError(t, store.Set(cfg.key("int"), 10, time.Hour))
+	var i int
+	require.NoError(t, store.Get(cfg.key("int"), &i))
+	require.Equal(t, 10, i)
+
+	require.NoError(t, store.Set(cfg.key("bytes"), []byte{0, 1, 0xff}, time.Hour))
+	var b []byte
+	require.NoError(t, store.Get(cfg.key("bytes"), &b))
+	require.Equal(t, []byte{0, 1, 0xff}, b)
+}
+
+func testMiss(t *testing.T, store persist.Store, cfg *config) {
+	var s string
+	err := store.Get(cfg.key("notexist"), &s)
+	require.ErrorIs(t, err, persist.ErrCacheMiss)
+	require.Empty(t, s)
+}
+
+func testDelete(t *testing.T, store persist.Store, cfg *config) {
+	require.NoError(t, store.Set(cfg.key("key"), "foo", time.Hour))
+	require.NoError(t, store.Delete(cfg.key("key")))
+	var s string
+	require.ErrorIs(t, store.Get(cfg.key("key"), &s), persist.ErrCacheMiss)
+
+	// deleting a missing key is not an error.
+	require.NoError(t, store.Delete(cfg.key("notexist")))
+}
+
+func testOverwrite(t *testing.T, store persist.Store, cfg *config) {
+	require.NoError(t, store.Set(cfg.key("key"), "foo", time.Hour))
+	require.NoError(t, store.Set(cfg.key("key"), "bar", time.Hour))
+	var s string
+	require.NoError(t, store.Get(cfg.key("key"), &s))
+	require.Equal(t, "bar", s)
+
+	// the expiration is overwritten too.
+	require.NoError(t, store.Set(cfg.key("key"), "baz", persist.NoExpiration))
+	if ttler, ok := store.(persist.TTLer); ok {
+		ttl, err := ttler.TTL(cfg.key("key"))
+		require.NoError(t, err)
+		require.Equal(t, persist.NoExpiration, ttl)
+	}
+}
+
+func testExpiration(t *testing.T, store persist.Store, cfg *config) {
+	resolution := cfg.resolution
+	require.NoError(t, store.Set(cfg.key("short"), "v", resolution))
+	require.NoError(t, store.Set(cfg.key("long"), "v", time.Hour))
+	require.NoError(t, store.Set(cfg.key("forever"), "v", persist.NoExpiration))
+	time.Sleep(2 * resolution)
+
+	var s string
+	require.ErrorIs(t, store.Get(cfg.key("short"), &s), persist.ErrCacheMiss)
+	require.NoError(t, store.Get(cfg.key("long"), &s))
+	require.NoError(t, store.Get(cfg.key("forever"), &s))
+}
+
+func testConcurrent(t *testing.T, store persist.Store, cfg *config) {
+	const (
+		workers = 8
+		rounds  = 100
+	)
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				shared := cfg.key(fmt.Sprintf("shared:%d", i%10))
+				own := cfg.key(fmt.Sprintf("own:%d:%d", w, i))
+				if err := store.Set(shared, shared, time.Hour); err != nil {
+					errs <- err
+					return
+				}
+				if err := store.Set(own, own, time.Hour); err != nil {
+					errs <- err
+					return
+				}
+				var s string
+				if err := store.Get(shared, &s); err != nil && !errors.Is(err, persist.ErrCacheMiss) {
+					errs <- err
+					return
+				} else if err == nil && s != shared {
+					errs <- fmt.Errorf("get %q: got %q", shared, s)
+					return
+				}
+				if err := store.Get(own, &s); err != nil || s != own {
+					errs <- fmt.Errorf("get %q: got %q, %v", own, s, err)
+					return
+				}
+				if err := store.Delete(shared); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+}
+
+// encodings the built-in encodings.
+func encodings(t *testing.T) map[string]cache.Encoding {
+	ring, err := cache.NewKeyRing(cache.Key{ID: 1, Secret: make([]byte, 32)})
+	require.NoError(t, err)
+	return map[string]cache.Encoding{
+		"JSON":             cache.JSONEncoding{},
+		"JSONGzip":         cache.JSONGzipEncoding{},
+		"Binary":           cache.BinaryEncoding{},
+		"EnvelopeJSON":     cache.NewEnvelopeEncoding(cache.JSONEncoding{}),
+		"EnvelopeJSONGzip": cache.NewEnvelopeEncoding(cache.JSONGzipEncoding{}),
+		"EnvelopeBinary":   cache.NewEnvelopeEncoding(cache.BinaryEncoding{}),
+		"Encrypted":        cache.NewEncryptedEncoding(cache.BinaryEncoding{}, ring),
+	}
+}
+
+// testBodyCache round-trips the response through the middleware with each encoding.
+func testBodyCache(t *testing.T, newStore Factory) {
+	gin.SetMode(gin.TestMode)
+	body := []byte("hello\x00world\xff")
+	for name, encode := range encodings(t) {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			count := 0
+			r := gin.New()
+			r.GET("/cache", cache.CacheWithRequestURI(store, time.Hour, func(c *gin.Context) {
+				count++
+				c.Header("X-Custom", "a")
+				c.Writer.Header().Add("X-Custom", "b")
+				c.Data(http.StatusOK, "application/octet-stream", body)
+			}, cache.WithEncoding(encode)))
+
+			for i := 0; i < 2; i++ {
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/cache", nil))
+				require.Equal(t, http.StatusOK, w.Code)
+				require.Equal(t, body, w.Body.Bytes())
+				require.Equal(t, []string{"a", "b"}, w.Header().Values("X-Custom"))
+				require.Equal(t, "application/octet-stream", w.Header().Get("Content-Type"))
+			}
+			require.Equal(t, 1, count, "the second request must be served from the store")
+		})
+	}
+}
+
+func testCapabilities(t *testing.T, store persist.Store, cfg *config) {
+	require.NoError(t, persist.SetMulti(store, map[string]any{
+		cfg.key("page:a"): "a",
+		cfg.key("page:b"): "b",
+		cfg.key("other"):  "c",
+	}, time.Hour))
+	require.NoError(t, store.Set(cfg.key("forever"), "d", persist.NoExpiration))
+
+	if ttler, ok := store.(persist.TTLer); ok {
+		t.Run("TTL", func(t *testing.T) {
+			ttl, err := ttler.TTL(cfg.key("page:a"))
+			require.NoError(t, err)
+			require.True(t, ttl > time.Minute && ttl <= time.Hour)
+			ttl, err = ttler.TTL(cfg.key("forever"))
+			require.NoError(t, err)
+			require.Equal(t, persist.NoExpiration, ttl)
+			_, err = ttler.TTL(cfg.key("notexist"))
+			require.ErrorIs(t, err, persist.ErrCacheMiss)
+		})
+	}
+
+	if exister, ok := store.(persist.Exister); ok {
+		t.Run("Exists", func(t *testing.T) {
+			exists, err := exister.Exists(cfg.key("page:a"))
+			require.NoError(t, err)
+			require.True(t, exists)
+			exists, err = exister.Exists(cfg.key("notexist"))
+			require.NoError(t, err)
+			require.False(t, exists)
+		})
+	}
+
+	t.Run("GetMulti", func(t *testing.T) {
+		var a, b, c string
+		found, err := persist.GetMulti(store, []string{cfg.key("page:a"), cfg.key("notexist"), cfg.key("page:b")}, []any{&a, &c, &b})
+		require.NoError(t, err)
+		require.Equal(t, []bool{true, false, true}, found)
+		require.Equal(t, "a", a)
+		require.Equal(t, "b", b)
+	})
+
+	if stater, ok := store.(persist.Stater); ok {
+		t.Run("Stat", func(t *testing.T) {
+			n, err := stater.Len()
+			require.NoError(t, err)
+			require.Equal(t, 4, n)
+			size, err := stater.Size()
+			require.NoError(t, err)
+			require.Greater(t, size, int64(0))
+		})
+	}
+
+	if deleter, ok := store.(persist.PrefixDeleter); ok {
+		t.Run("DeleteByPrefix", func(t *testing.T) {
+			deleted, err := deleter.DeleteByPrefix(cfg.key("page:"))
+			require.NoError(t, err)
+			require.Equal(t, 2, deleted)
+			var s string
+			require.ErrorIs(t, store.Get(cfg.key("page:a"), &s), persist.ErrCacheMiss)
+			require.NoError(t, store.Get(cfg.key("other"), &s))
+		})
+	}
+
+	if clearer, ok := store.(persist.Clearer); ok {
+		t.Run("Clear", func(t *testing.T) {
+			require.NoError(t, clearer.Clear())
+			var s string
+			require.ErrorIs(t, store.Get(cfg.key("other"), &s), persist.ErrCacheMiss)
+			require.ErrorIs(t, store.Get(cfg.key("forever"), &s), persist.ErrCacheMiss)
+			if stater, ok := store.(persist.Stater); ok {
+				n, err := stater.Len()
+				require.NoError(t, err)
+				require.Equal(t, 0, n)
+			}
+		})
+	}
+}
+
+func testLock(t *testing.T, store persist.Store, cfg *config) {
+	locker, ok := store.(persist.Locker)
+	if !ok {
+		t.Skip("the store does not implement persist.Locker")
+	}
+
+	acquired, err := locker.Lock(cfg.key("lock"), "a", time.Hour)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	acquired, err = locker.Lock(cfg.key("lock"), "b", time.Hour)
+	require.NoError(t, err)
+	require.False(t, acquired)
+
+	// the lock is released only by its holder.
+	require.NoError(t, locker.Unlock(cfg.key("lock"), "b"))
+	acquired, err = locker.Lock(cfg.key("lock"), "b", time.Hour)
+	require.NoError(t, err)
+	require.False(t, acquired)
+	require.NoError(t, locker.Unlock(cfg.key("lock"), "a"))
+	acquired, err = locker.Lock(cfg.key("lock"), "b", time.Hour)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	require.NoError(t, locker.Unlock(cfg.key("lock"), "b"))
+
+	// unlocking a missing lock is not an error.
+	require.NoError(t, locker.Unlock(cfg.key("notexist"), "a"))
+}
@@ -0,0 +1,262 @@
+// Package tiered implements a two-tier store, a bounded in-process L1 in front of the redis L2,
+// the changes are published over redis pub/sub, so the other nodes drop their L1 copies.
+package tiered
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/things-go/gin-cache/persist"
+	redisStore "github.com/things-go/gin-cache/persist/redis"
+)
+
+// DefaultChannel the default invalidation channel.
+const DefaultChannel = "gincache.tiered.invalidate"
+
+// invalidation message: op(1 byte) | node id | ' ' | key or prefix
+const (
+	opDelete = 'd'
+	opPrefix = 'p'
+	opClear  = 'c'
+)
+
+// Store two-tier store
+type Store struct {
+	l1      *lru
+	l1TTL   time.Duration
+	l2      *redisStore.Store
+	channel string
+	nodeID  string
+
+	pubsub *redis.PubSub
+	done   chan struct{}
+	once   sync.Once
+}
+
+// Option custom option
+type Option func(*Store)
+
+// WithL1Size custom the maximum number of items in L1, default is 10000.
+func WithL1Size(size int) Option {
+	return func(s *Store) {
+		if size > 0 {
+			s.l1 = newLRU(size)
+		}
+	}
+}
+
+// WithL1TTL custom the time to live of the L1 items, default is 5 seconds.
+func WithL1TTL(ttl time.Duration) Option {
+	return func(s *Store) {
+		if ttl > 0 {
+			s.l1TTL = ttl
+		}
+	}
+}
+
+// WithChannel custom invalidation channel, default is DefaultChannel.
+func WithChannel(channel string) Option {
+	return func(s *Store) {
+		if channel != "" {
+			s.channel = channel
+		}
+	}
+}
+
+var _ persist.Store = (*Store)(nil)
+var _ persist.TTLer = (*Store)(nil)
+var _ persist.Exister = (*Store)(nil)
+var _ persist.PrefixDeleter = (*Store)(nil)
+var _ persist.Clearer = (*Store)(nil)
+var _ persist.Locker = (*Store)(nil)
+
+// NewStore new two-tier store in front of the redis store,
+// it subscribes the invalidation channel until Close.
+func NewStore(l2 *redisStore.Store, opts ...Option) (*Store, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		l1:      newLRU(10000),
+		l1TTL:   5 * time.Second,
+		l2:      l2,
+		channel: DefaultChannel,
+		nodeID:  hex.EncodeToString(id),
+		done:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	ctx := context.Background()
+	s.pubsub = l2.Redisc.Subscribe(ctx, s.channel)
+	// wait for the confirmation, so no invalidation is missed after return.
+	if _, err := s.pubsub.Receive(ctx); err != nil {
+		s.pubsub.Close()
+		return nil, err
+	}
+	go s.listen()
+	return s, nil
+}
+
+// Close stops subscribing the invalidation channel.
+func (s *Store) Close() error {
+	var err error
+	s.once.Do(func() {
+		err = s.pubsub.Close()
+		<-s.done
+	})
+	return err
+}
+
+// Set implement persist.Store interface
+func (s *Store) Set(key string, value any, expire time.Duration) error {
+	if err := s.l2.Set(key, value, expire); err != nil {
+		return err
+	}
+	// the other nodes hold the stale copy.
+	s.l1.delete(key)
+	return s.publish(opDelete, key)
+}
+
+// Get implement persist.Store interface
+func (s *Store) Get(key string, value any) error {
+	if v, ok := s.l1.get(key); ok {
+		rv := reflect.ValueOf(value)
+		if rv.Kind() == reflect.Ptr && rv.Elem().CanSet() {
+			rv.Elem().Set(reflect.Indirect(reflect.ValueOf(v)))
+		}
+		return nil
+	}
+	ttl, err := s.getL2(key, value)
+	if err != nil {
+		return err
+	}
+	// the value is decoded into the caller's value, keep a copy.
+	rv := reflect.ValueOf(value)
+	if ttl > 0 && rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		cp := reflect.New(rv.Elem().Type())
+		cp.Elem().Set(rv.Elem())
+		s.l1.set(key, cp.Interface(), ttl)
+	}
+	return nil
+}
+
+// getL2 get the value from L2 with the time to live of the L1 copy,
+// which is capped at the remaining time to live of the L2 item,
+// so L1 never serves the item after L2 expired it.
+func (s *Store) getL2(key string, value any) (time.Duration, error) {
+	ctx := context.Background()
+	var get *redis.StringCmd
+	var pttl *redis.DurationCmd
+	_, err := s.l2.Redisc.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		pttl = pipe.PTTL(ctx, key)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return 0, err
+	}
+	if err = get.Scan(value); err != nil {
+		if err == redis.Nil {
+			return 0, persist.ErrCacheMiss
+		}
+		return 0, err
+	}
+	ttl := s.l1TTL
+	// -1 the key has no expiration, -2 the key expired in between.
+	if d := pttl.Val(); d >= 0 && d < ttl {
+		ttl = d
+	}
+	return ttl, nil
+}
+
+// Delete implement persist.Store interface
+func (s *Store) Delete(key string) error {
+	s.l1.delete(key)
+	if err := s.l2.Delete(key); err != nil {
+		return err
+	}
+	return s.publish(opDelete, key)
+}
+
+// TTL implement persist.TTLer interface, the time to live of the L2 item.
+func (s *Store) TTL(key string) (time.Duration, error) {
+	return s.l2.TTL(key)
+}
+
+// Exists implement persist.Exister interface
+func (s *Store) Exists(key string) (bool, error) {
+	if _, ok := s.l1.get(key); ok {
+		return true, nil
+	}
+	return s.l2.Exists(key)
+}
+
+// DeleteByPrefix implement persist.PrefixDeleter interface
+func (s *Store) DeleteByPrefix(prefix string) (int, error) {
+	s.l1.deletePrefix(prefix)
+	n, err := s.l2.DeleteByPrefix(prefix)
+	if err != nil {
+		return n, err
+	}
+	return n, s.publish(opPrefix, prefix)
+}
+
+// Clear implement persist.Clearer interface
+func (s *Store) Clear() error {
+	s.l1.clear()
+	if err := s.l2.Clear(); err != nil {
+		return err
+	}
+	return s.publish(opClear, "")
+}
+
+// Lock implement persist.Locker interface, the lock is held in L2, so it is shared by all nodes.
+func (s *Store) Lock(key, token string, ttl time.Duration) (bool, error) {
+	return s.l2.Lock(key, token, ttl)
+}
+
+// Unlock implement persist.Locker interface
+func (s *Store) Unlock(key, token string) error {
+	return s.l2.Unlock(key, token)
+}
+
+func (s *Store) publish(op byte, key string) error {
+	msg := string(op) + s.nodeID + " " + key
+	return s.l2.Redisc.Publish(context.Background(), s.channel, msg).Err()
+}
+
+func (s *Store) listen() {
+	defer close(s.done)
+	for msg := range s.pubsub.Channel() {
+		s.invalidate(msg.Payload)
+	}
+}
+
+func (s *Store) invalidate(payload string) {
+	if len(payload) == 0 {
+		return
+	}
+	op := payload[0]
+	nodeID, key, ok := strings.Cut(payload[1:], " ")
+	if !ok || nodeID == s.nodeID {
+		return
+	}
+	switch op {
+	case opDelete:
+		s.l1.delete(key)
+	case opPrefix:
+		s.l1.deletePrefix(key)
+	case opClear:
+		s.l1.clear()
+	}
+}
@@ -0,0 +1,148 @@
+package tiered
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/gin-cache/internal/redistest"
+	"github.com/things-go/gin-cache/persist"
+	redisStore "github.com/things-go/gin-cache/persist/redis"
+	"github.com/things-go/gin-cache/persist/storetest"
+)
+
+// testPrefix the keys of the suite.
+const testPrefix = "gincache.storetest:"
+
+// unlockSource the unlock script of the redis store, which the fake server implements in Go.
+const unlockSource = `if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`
+
+func newTieredStore(t *testing.T, srv *redistest.Server, opts ...Option) *Store {
+	srv.RegisterScript(unlockSource, func(db *redistest.DB, keys, args []string) any {
+		if v, ok := db.Get(keys[0]); ok && v == args[0] {
+			db.Del(keys[0])
+			return int64(1)
+		}
+		return int64(0)
+	})
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { client.Close() })
+	s, err := NewStore(redisStore.NewStore(client, redisStore.WithKeyPrefix(testPrefix)), opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func Test_Tiered_Store(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) persist.Store {
+		return newTieredStore(t, redistest.Run(t))
+	}, storetest.WithResolution(50*time.Millisecond), storetest.WithKeyPrefix(testPrefix))
+}
+
+func Test_Tiered_typicalGetSet(t *testing.T) {
+	store := newTieredStore(t, redistest.Run(t))
+
+	value := "foo"
+	err := store.Set("value", value, time.Hour)
+	require.NoError(t, err)
+
+	value = ""
+	err = store.Get("value", &value)
+	require.NoError(t, err)
+	require.Equal(t, "foo", value)
+
+	// from L1
+	value = ""
+	err = store.Get("value", &value)
+	require.NoError(t, err)
+	require.Equal(t, "foo", value)
+
+	err = store.Delete("value")
+	require.NoError(t, err)
+	err = store.Get("value", &value)
+	require.ErrorIs(t, err, persist.ErrCacheMiss)
+
+	err = store.Get("notexist", &value)
+	require.ErrorIs(t, err, persist.ErrCacheMiss)
+}
+
+func Test_Tiered_L1(t *testing.T) {
+	srv := redistest.Run(t)
+	store := newTieredStore(t, srv, WithL1TTL(time.Millisecond*100), WithL1Size(2))
+
+	require.NoError(t, store.Set("a", "a", time.Hour))
+	var value string
+	require.NoError(t, store.Get("a", &value))
+
+	// removed from L2 behind the store's back, still served from L1.
+	raw := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	defer raw.Close()
+	require.NoError(t, raw.Del(raw.Context(), "a").Err())
+	value = ""
+	require.NoError(t, store.Get("a", &value))
+	require.Equal(t, "a", value)
+
+	// L1 expired.
+	time.Sleep(time.Millisecond * 150)
+	require.ErrorIs(t, store.Get("a", &value), persist.ErrCacheMiss)
+
+	// bounded
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprint(i)
+		require.NoError(t, store.Set(key, key, time.Hour))
+		require.NoError(t, store.Get(key, &value))
+	}
+	require.Equal(t, 2, store.l1.len())
+}
+
+func Test_Tiered_L1CappedAtL2TTL(t *testing.T) {
+	store := newTieredStore(t, redistest.Run(t), WithL1TTL(time.Hour))
+
+	require.NoError(t, store.Set("a", "a", time.Millisecond*100))
+	var value string
+	require.NoError(t, store.Get("a", &value))
+	require.Equal(t, "a", value)
+
+	// L2 expired, L1 does not outlive it.
+	time.Sleep(time.Millisecond * 150)
+	require.ErrorIs(t, store.Get("a", &value), persist.ErrCacheMiss)
+}
+
+func Test_Tiered_Invalidation(t *testing.T) {
+	srv := redistest.Run(t)
+	node1 := newTieredStore(t, srv)
+	node2 := newTieredStore(t, srv)
+
+	var value string
+	require.NoError(t, node1.Set("page:a", "v1", time.Hour))
+	require.NoError(t, node1.Set("page:b", "v1", time.Hour))
+	require.NoError(t, node2.Get("page:a", &value))
+	require.NoError(t, node2.Get("page:b", &value))
+	require.Equal(t, 2, node2.l1.len())
+
+	// overwrite on node1, node2 drops its L1 copy.
+	require.NoError(t, node1.Set("page:a", "v2", time.Hour))
+	require.Eventually(t, func() bool { return node2.l1.len() == 1 }, time.Second, time.Millisecond*10)
+	require.NoError(t, node2.Get("page:a", &value))
+	require.Equal(t, "v2", value)
+
+	require.NoError(t, node1.Delete("page:a"))
+	require.Eventually(t, func() bool { return node2.l1.len() == 1 }, time.Second, time.Millisecond*10)
+	require.ErrorIs(t, node2.Get("page:a", &value), persist.ErrCacheMiss)
+
+	n, err := node1.DeleteByPrefix("page:")
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Eventually(t, func() bool { return node2.l1.len() == 0 }, time.Second, time.Millisecond*10)
+
+	require.NoError(t, node1.Set("page:c", "v1", time.Hour))
+	require.NoError(t, node2.Get("page:c", &value))
+	require.NoError(t, node1.Clear())
+	require.Eventually(t, func() bool { return node2.l1.len() == 0 }, time.Second, time.Millisecond*10)
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ErrorPolicy how to handle the store errors other than persist.ErrCacheMiss.
+type ErrorPolicy int
+
+const (
+	// ErrorPolicyMiss treat the error as a cache miss, run the handler and try to store the response.
+	ErrorPolicyMiss ErrorPolicy = iota
+	// ErrorPolicyBypass run the handler without storing the response.
+	ErrorPolicyBypass
+	// ErrorPolicyFail abort the request with 503 Service Unavailable.
+	ErrorPolicyFail
+)
+
+// String implement fmt.Stringer interface.
+func (p ErrorPolicy) String() string {
+	switch p {
+	case ErrorPolicyMiss:
+		return "miss"
+	case ErrorPolicyBypass:
+		return "bypass"
+	case ErrorPolicyFail:
+		return "fail"
+	default:
+		return "unknown"
+	}
+}
+
+// WithErrorPolicy custom store error policy, default is ErrorPolicyMiss.
+func WithErrorPolicy(p ErrorPolicy) Option {
+	return func(c *Config) {
+		c.errorPolicy = p
+	}
+}
+
+// WithErrorLogInterval custom the minimum interval between two store error logs,
+// the errors in the interval are counted and reported with the next log.
+// default is 10 seconds, zero or negative logs every error.
+func WithErrorLogInterval(d time.Duration) Option {
+	return func(c *Config) {
+		c.errorLogInterval = d
+	}
+}
+
+// rateLimitLogger a Logger which logs at most once per interval.
+type rateLimitLogger struct {
+	logger     Logger
+	interval   int64
+	last       atomic.Int64
+	suppressed atomic.Int64
+}
+
+var _ Logger = (*rateLimitLogger)(nil)
+
+func newRateLimitLogger(l Logger, interval time.Duration) *rateLimitLogger {
+	return &rateLimitLogger{logger: l, interval: int64(interval)}
+}
+
+// Errorf implement Logger interface.
+func (l *rateLimitLogger) Errorf(format string, args ...any) {
+	if l.interval > 0 {
+		now := time.Now().UnixNano()
+		last := l.last.Load()
+		if (last != 0 && now-last < l.interval) || !l.last.CompareAndSwap(last, now) {
+			l.suppressed.Add(1)
+			return
+		}
+	}
+	if n := l.suppressed.Swap(0); n > 0 {
+		format += ", %d errors suppressed"
+		args = append(args, n)
+	}
+	l.logger.Errorf(format, args...)
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordLogger struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *recordLogger) Errorf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs = append(l.logs, fmt.Sprintf(format, args...))
+}
+
+// countStore counts the Set calls of the wrapped store
+type countStore struct {
+	errorStore
+	sets int
+}
+
+func (s *countStore) Set(key string, value any, expire time.Duration) error {
+	s.sets++
+	return s.errorStore.Set(key, value, expire)
+}
+
+func TestCacheErrorPolicy(t *testing.T) {
+	tests := []struct {
+		policy   ErrorPolicy
+		wantCode int
+		wantSets int
+		wantLogs int
+	}{
+		{ErrorPolicyMiss, http.StatusOK, 1, 1},
+		{ErrorPolicyBypass, http.StatusOK, 0, 1},
+		{ErrorPolicyFail, http.StatusServiceUnavailable, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			store := &countStore{errorStore: errorStore{errors.New("connection refused")}}
+			logger := &recordLogger{}
+
+			r := gin.New()
+			r.GET("/cache/policy", Cache(store, time.Second*3, func(c *gin.Context) {
+				c.String(http.StatusOK, "pong")
+			}, WithErrorPolicy(tt.policy), WithLogger(logger)))
+
+			w := performRequest("/cache/policy", r)
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantSets, store.sets)
+			// the set error is rate limited after the get error.
+			assert.Len(t, logger.logs, tt.wantLogs)
+		})
+	}
+}
+
+func TestCacheMissNotLogged(t *testing.T) {
+	logger := &recordLogger{}
+
+	r := gin.New()
+	r.GET("/cache/miss", Cache(newStore(time.Second*60), time.Second*3, func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	}, WithLogger(logger)))
+
+	w := performRequest("/cache/miss", r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, logger.logs)
+}
+
+func TestRateLimitLogger(t *testing.T) {
+	logger := &recordLogger{}
+
+	l := newRateLimitLogger(logger, time.Millisecond*100)
+	l.Errorf("error %d", 1)
+	l.Errorf("error %d", 2)
+	l.Errorf("error %d", 3)
+	require.Equal(t, []string{"error 1"}, logger.logs)
+
+	time.Sleep(time.Millisecond * 150)
+	l.Errorf("error %d", 4)
+	require.Equal(t, []string{"error 1", "error 4, 2 errors suppressed"}, logger.logs)
+
+	logger.logs = nil
+	l = newRateLimitLogger(logger, 0)
+	l.Errorf("error %d", 1)
+	l.Errorf("error %d", 2)
+	require.Equal(t, []string{"error 1", "error 2"}, logger.logs)
+}
@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveRange serve the byte-range request from the cached entry, which supports
+// Range, If-Range and multipart ranges, reports whether it is served.
+func (cfg *Config) serveRange(c *gin.Context, bodyCache *BodyCache) bool {
+	if c.Request.Method != http.MethodGet ||
+		bodyCache.Status != http.StatusOK ||
+		c.Request.Header.Get("Range") == "" {
+		return false
+	}
+
+	data := bodyCache.Data
+	reader, decompress := cfg.decompressReader(c, bodyCache)
+	if decompress {
+		var err error
+		data, err = io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			cfg.logger.Errorf("decompress cache body error: %s", err)
+			return false
+		}
+	}
+
+	cfg.replayHeader(c, bodyCache, decompress)
+	var modtime time.Time
+	if lm := bodyCache.Header.Get("Last-Modified"); lm != "" {
+		modtime, _ = http.ParseTime(lm) // nolint: errcheck
+	}
+	http.ServeContent(c.Writer, c.Request, "", modtime, bytes.NewReader(data))
+	return true
+}
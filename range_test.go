@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const rangeBody = "0123456789abcdefghij"
+
+func newRangeRouter(count *int) *gin.Engine {
+	r := gin.New()
+	r.GET("/cache/range", Cache(newBinaryStore(), time.Second*3, func(c *gin.Context) {
+		*count++
+		c.Header("ETag", `"v1"`)
+		// honors Range itself, the middleware must store the full representation.
+		http.ServeContent(c.Writer, c.Request, "", time.Time{}, strings.NewReader(rangeBody))
+	}, WithEncoding(BinaryEncoding{})))
+	return r
+}
+
+func TestCacheRangeMiss(t *testing.T) {
+	count := 0
+	r := newRangeRouter(&count)
+
+	w1 := performRequestWithHeader("/cache/range", r, http.Header{"Range": {"bytes=0-3"}})
+	assert.Equal(t, http.StatusOK, w1.Code)
+	assert.Equal(t, rangeBody, w1.Body.String())
+
+	w2 := performRequest("/cache/range", r)
+	assert.Equal(t, http.StatusOK, w2.Code)
+	assert.Equal(t, rangeBody, w2.Body.String())
+	assert.Equal(t, 1, count)
+}
+
+func TestCacheRangeHit(t *testing.T) {
+	count := 0
+	r := newRangeRouter(&count)
+	performRequest("/cache/range", r)
+
+	w := performRequestWithHeader("/cache/range", r, http.Header{"Range": {"bytes=2-5"}})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "2345", w.Body.String())
+	assert.Equal(t, "bytes 2-5/20", w.Header().Get("Content-Range"))
+	assert.Equal(t, "4", w.Header().Get("Content-Length"))
+
+	w = performRequestWithHeader("/cache/range", r, http.Header{"Range": {"bytes=-3"}, "If-Range": {`"v1"`}})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "hij", w.Body.String())
+
+	// stale validator, the full representation.
+	w = performRequestWithHeader("/cache/range", r, http.Header{"Range": {"bytes=2-5"}, "If-Range": {`"v0"`}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, rangeBody, w.Body.String())
+
+	w = performRequestWithHeader("/cache/range", r, http.Header{"Range": {"bytes=100-"}})
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+	assert.Equal(t, 1, count)
+}
+
+func TestCacheRangeMultipart(t *testing.T) {
+	count := 0
+	r := newRangeRouter(&count)
+	performRequest("/cache/range", r)
+
+	w := performRequestWithHeader("/cache/range", r, http.Header{"Range": {"bytes=0-1,10-12"}})
+	require.Equal(t, http.StatusPartialContent, w.Code)
+
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/byteranges", mediaType)
+
+	mr := multipart.NewReader(w.Body, params["boundary"])
+	var parts []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		b, err := io.ReadAll(p)
+		require.NoError(t, err)
+		parts = append(parts, p.Header.Get("Content-Range")+" "+string(b))
+	}
+	assert.Equal(t, []string{"bytes 0-1/20 01", "bytes 10-12/20 abc"}, parts)
+}
+
+func TestCacheRangeDecompress(t *testing.T) {
+	body := strings.Repeat("0123456789", 20)
+	r := gin.New()
+	r.GET("/cache/range", Cache(newBinaryStore(), time.Second*3, func(c *gin.Context) {
+		c.String(http.StatusOK, body)
+	}, WithCompression(CompressGzip, 64)))
+	performRequest("/cache/range", r)
+
+	w := performRequestWithHeader("/cache/range", r, http.Header{"Range": {"bytes=10-14"}})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "01234", w.Body.String())
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+}
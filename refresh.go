@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WithEarlyRefresh enables the probabilistic early expiration, known as XFetch.
+// on a hit the entry is refreshed in the background before it expires, with a probability which grows
+// as the expiration approaches and with the time the handler took to generate the entry,
+// so the regeneration of the popular keys spreads out rather than happening at the same moment.
+// beta scales the probability, 1 is the default of the algorithm, the larger the earlier,
+// zero or negative disables it.
+func WithEarlyRefresh(beta float64) Option {
+	return func(c *Config) {
+		c.earlyBeta = beta
+	}
+}
+
+// shouldRefreshEarly reports whether the entry is refreshed before it expires by XFetch,
+// which refreshes if now - computeTime * beta * ln(rand()) >= expireAt, rand() in (0, 1].
+func (cfg *Config) shouldRefreshEarly(bc *BodyCache) bool {
+	if cfg.earlyBeta <= 0 || bc.ExpireAt.IsZero() || bc.ComputeTime <= 0 {
+		return false
+	}
+	gap := -float64(bc.ComputeTime) * cfg.earlyBeta * math.Log(cfg.random())
+	return float64(bc.ExpireAt.Sub(cfg.clock.Now())) <= gap
+}
+
+// randomFloat returns a random number in (0, 1].
+func randomFloat() float64 { return 1 - rand.Float64() }
+
+// refresh regenerates the entry of key in the background by a worker, with a request made of captured,
+// or a copy of the request if nothing is captured.
+// at most one refresh of a key runs at a time in the process, the refresh is dropped if all the workers are busy.
+func (cfg *Config) refresh(c *gin.Context, key string, handle gin.HandlerFunc, captured *CapturedRequest) {
+	if _, loaded := cfg.refreshing.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+	done := func() { cfg.refreshing.Delete(key) }
+
+	cp := c.Copy()
+	if captured == nil {
+		cp.Request = refreshRequest(c.Request)
+	} else {
+		req, err := captured.newRequest()
+		if err != nil {
+			done()
+			cfg.errorLogger.Errorf("refresh cache key error: %s, cache key: %s", err, key)
+			return
+		}
+		// the values set by the middlewares belong to the client of the current request.
+		cp.Keys = nil
+		cp.Request = req
+	}
+
+	select {
+	case cfg.refreshSem <- struct{}{}:
+	default:
+		done()
+		return
+	}
+	go func() {
+		defer func() {
+			<-cfg.refreshSem
+			done()
+		}()
+		cfg.runRefresh(cp, key, handle)
+	}()
+}
+
+// refreshRequest returns a copy of req for the background refresh, which outlives req,
+// and always fetches the full representation.
+func refreshRequest(req *http.Request) *http.Request {
+	r := req.Clone(context.WithoutCancel(req.Context()))
+	for _, k := range []string{"Range", "If-Range", "If-None-Match", "If-Modified-Since"} {
+		r.Header.Del(k)
+	}
+	return r
+}
+
+// runRefresh runs the handler with c, which is detached from the client, and stores the response.
+// the copied context is always aborted, so the response is stored regardless of c.IsAborted.
+func (cfg *Config) runRefresh(c *gin.Context, key string, handle gin.HandlerFunc) {
+	defer func() {
+		if r := recover(); r != nil {
+			cfg.errorLogger.Errorf("refresh cache key panic: %v, cache key: %s", r, key)
+		}
+	}()
+
+	bodyWriter := &BodyWriter{ResponseWriter: &discardWriter{header: make(http.Header)}}
+	c.Writer = bodyWriter
+	bc := cfg.runHandler(c, c.Request.Context(), key, handle, bodyWriter)
+	if cfg.headerPolicy.sanitize(bc.Header) && cacheableStatus(bodyWriter.Status()) {
+		cfg.storeBodyCache(c, c.Request.Context(), key, bc)
+	}
+}
+
+// discardWriter a gin.ResponseWriter for the background refresh, which discards the response,
+// the response is captured by BodyWriter.
+type discardWriter struct {
+	header  http.Header
+	status  int
+	size    int
+	written bool
+}
+
+var _ gin.ResponseWriter = (*discardWriter)(nil)
+
+var errRefreshHijack = errors.New("gincache: the background refresh can not be hijacked")
+
+// Header implement http.ResponseWriter interface.
+func (w *discardWriter) Header() http.Header { return w.header }
+
+// WriteHeader implement http.ResponseWriter interface.
+func (w *discardWriter) WriteHeader(code int) {
+	if code > 0 && !w.Written() {
+		w.status = code
+	}
+}
+
+// Write implement http.ResponseWriter interface.
+func (w *discardWriter) Write(b []byte) (int, error) {
+	w.WriteHeaderNow()
+	w.size += len(b)
+	return len(b), nil
+}
+
+// WriteString implement gin.ResponseWriter interface.
+func (w *discardWriter) WriteString(s string) (int, error) {
+	w.WriteHeaderNow()
+	w.size += len(s)
+	return len(s), nil
+}
+
+// Status implement gin.ResponseWriter interface.
+func (w *discardWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Size implement gin.ResponseWriter interface.
+func (w *discardWriter) Size() int { return w.size }
+
+// Written implement gin.ResponseWriter interface.
+func (w *discardWriter) Written() bool { return w.written }
+
+// WriteHeaderNow implement gin.ResponseWriter interface.
+func (w *discardWriter) WriteHeaderNow() {
+	if !w.written {
+		w.written = true
+		w.status = w.Status()
+	}
+}
+
+// Hijack implement http.Hijacker interface, which always fails.
+func (w *discardWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errRefreshHijack
+}
+
+// Flush implement http.Flusher interface.
+func (w *discardWriter) Flush() {}
+
+// CloseNotify implement http.CloseNotifier interface, which never notifies.
+func (w *discardWriter) CloseNotify() <-chan bool { return make(chan bool) }
+
+// Pusher implement gin.ResponseWriter interface, which does not support server push.
+func (w *discardWriter) Pusher() http.Pusher { return nil }
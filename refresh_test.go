@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/gin-cache/cachetest"
+)
+
+// withRandom custom the random number source of the probabilistic early expiration.
+func withRandom(f func() float64) Option {
+	return func(c *Config) {
+		c.random = f
+	}
+}
+
+func TestShouldRefreshEarly(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := &Config{clock: cachetest.NewClock(now), earlyBeta: 1, random: func() float64 { return 0.5 }}
+	// ln(0.5) * 10s is about 6.93s before the expiration.
+	tests := []struct {
+		name string
+		bc   BodyCache
+		want bool
+	}{
+		{"far", BodyCache{ExpireAt: now.Add(10 * time.Second), ComputeTime: 10 * time.Second}, false},
+		{"near", BodyCache{ExpireAt: now.Add(6 * time.Second), ComputeTime: 10 * time.Second}, true},
+		{"expired", BodyCache{ExpireAt: now.Add(-time.Second), ComputeTime: 10 * time.Second}, true},
+		{"never expires", BodyCache{ComputeTime: 10 * time.Second}, false},
+		{"no compute time", BodyCache{ExpireAt: now.Add(time.Millisecond)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, cfg.shouldRefreshEarly(&tt.bc))
+		})
+	}
+
+	cfg.earlyBeta = 0
+	assert.False(t, cfg.shouldRefreshEarly(&BodyCache{ExpireAt: now, ComputeTime: time.Second}))
+	// the larger beta, the earlier.
+	cfg.earlyBeta = 2
+	assert.True(t, cfg.shouldRefreshEarly(&BodyCache{ExpireAt: now.Add(10 * time.Second), ComputeTime: 10 * time.Second}))
+}
+
+func TestCacheEarlyRefresh(t *testing.T) {
+	clock := cachetest.NewClock(time.Now())
+	store := cachetest.NewStore(cachetest.WithClock(clock))
+	var count atomic.Int32
+	stored := make(chan struct{}, 2)
+
+	r := gin.New()
+	r.GET("/cache/early", Cache(store, time.Minute, func(c *gin.Context) {
+		n := count.Add(1)
+		clock.Advance(10 * time.Second) // the handler takes 10s.
+		c.String(http.StatusOK, fmt.Sprint(n))
+	},
+		WithClock(clock),
+		WithEarlyRefresh(1),
+		withRandom(func() float64 { return 0.5 }),
+		WithHooks(Hooks{OnStore: func(*gin.Context, string, *BodyCache) { stored <- struct{}{} }}),
+	))
+
+	w := performRequest("/cache/early", r)
+	assert.Equal(t, "1", w.Body.String())
+	<-stored
+
+	// 10s before the expiration, not refreshed.
+	clock.Advance(50 * time.Second)
+	w = performRequest("/cache/early", r)
+	assert.Equal(t, "1", w.Body.String())
+	assert.Equal(t, int32(1), count.Load())
+
+	// 6s before the expiration, refreshed in the background, the stale entry is served.
+	clock.Advance(4 * time.Second)
+	// the background request always fetches the full representation.
+	w = performRequestWithHeader("/cache/early", r, http.Header{"Range": {"bytes=0-0"}})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "1", w.Body.String())
+	select {
+	case <-stored:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the entry is not refreshed")
+	}
+	assert.Equal(t, int32(2), count.Load())
+
+	w = performRequest("/cache/early", r)
+	assert.Equal(t, "2", w.Body.String())
+	assert.Equal(t, int32(2), count.Load())
+}
+
+func TestCacheEarlyRefreshPanic(t *testing.T) {
+	clock := cachetest.NewClock(time.Now())
+	store := cachetest.NewStore(cachetest.WithClock(clock))
+	logger := &recordLogger{}
+	var count atomic.Int32
+	done := make(chan struct{})
+
+	r := gin.New()
+	r.GET("/cache/early", Cache(store, time.Minute, func(c *gin.Context) {
+		clock.Advance(10 * time.Second)
+		if count.Add(1) > 1 {
+			defer close(done)
+			panic("refresh failed")
+		}
+		c.String(http.StatusOK, "pong")
+	}, WithClock(clock), WithEarlyRefresh(1), WithLogger(logger), withRandom(func() float64 { return 0.5 })))
+
+	performRequest("/cache/early", r)
+	clock.Advance(55 * time.Second)
+	w := performRequest("/cache/early", r)
+	assert.Equal(t, "pong", w.Body.String())
+	<-done
+
+	require.Eventually(t, func() bool {
+		logger.mu.Lock()
+		defer logger.mu.Unlock()
+		return len(logger.logs) == 1
+	}, 5*time.Second, time.Millisecond)
+	assert.Contains(t, logger.logs[0], "refresh failed")
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// FollowerPolicy how to handle the follower of the single flight which waits the leader too long.
+type FollowerPolicy int
+
+const (
+	// FollowerPolicyBypass run the handler without storing the response.
+	FollowerPolicyBypass FollowerPolicy = iota
+	// FollowerPolicyFail abort the request with 504 Gateway Timeout.
+	FollowerPolicyFail
+)
+
+// String implement fmt.Stringer interface.
+func (p FollowerPolicy) String() string {
+	switch p {
+	case FollowerPolicyBypass:
+		return "bypass"
+	case FollowerPolicyFail:
+		return "fail"
+	default:
+		return "unknown"
+	}
+}
+
+// WithFollowerTimeout custom how long the followers of the single flight wait the leader,
+// which is the request running the handler, the followers waited longer are handled by p.
+// default is zero, the followers wait until the leader finishes.
+func WithFollowerTimeout(d time.Duration, p FollowerPolicy) Option {
+	return func(c *Config) {
+		c.followerTimeout = d
+		c.followerPolicy = p
+	}
+}
+
+// errFollowerTimeout the follower does not get the response of the leader in time.
+var errFollowerTimeout = errors.New("gincache: single flight follower timeout")
+
+// PanicError the panic of the handler run by the single flight, which is propagated to
+// the leader and the followers, so the followers never block on it.
+type PanicError struct {
+	// Value the value passed to panic.
+	Value any
+	// Stack the stack trace of the panic.
+	Stack []byte
+}
+
+// Error implement error interface.
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("gincache: handler panic: %v\n\n%s", p.Value, p.Stack)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (p *PanicError) Unwrap() error {
+	err, _ := p.Value.(error)
+	return err
+}
+
+// errLeaderAbandoned the leader of the flight has timed out before its call starts,
+// so the call does not run fn, and the followers of the flight run a new one.
+var errLeaderAbandoned = errors.New("gincache: single flight leader abandoned")
+
+// do runs fn by the single flight, the panic of fn is recovered and returned as *PanicError.
+// with the follower timeout, the follower returns errFollowerTimeout if the leader does not finish in time.
+func (cfg *Config) do(key string, fn func() (any, error)) (any, error) {
+	for {
+		v, err := cfg.doOnce(key, fn)
+		// the followers of an abandoned leader join or lead a new flight, so the handler still runs.
+		if err != errLeaderAbandoned {
+			return v, err
+		}
+	}
+}
+
+func (cfg *Config) doOnce(key string, fn func() (any, error)) (any, error) {
+	const (
+		pending int32 = iota
+		started
+		abandoned
+	)
+	// the state of the call of this request, which only runs if this request is the leader.
+	var state atomic.Int32
+	call := func() (v any, err error) {
+		if !state.CompareAndSwap(pending, started) {
+			// this request has timed out before the call starts, as it can not tell whether it is
+			// the leader until the call starts.
+			return nil, errLeaderAbandoned
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				err = &PanicError{Value: r, Stack: debug.Stack()}
+			}
+		}()
+		return fn()
+	}
+
+	if cfg.followerTimeout <= 0 {
+		v, err, _ := cfg.group.Do(key, call)
+		return v, err
+	}
+
+	ch := cfg.group.DoChan(key, call)
+	timer := time.NewTimer(cfg.followerTimeout)
+	defer timer.Stop()
+	select {
+	case res := <-ch:
+		return res.Val, res.Err
+	case <-timer.C:
+		if state.CompareAndSwap(pending, abandoned) {
+			return nil, errFollowerTimeout
+		}
+		// this request is the leader, waits its own handler.
+		res := <-ch
+		return res.Val, res.Err
+	}
+}
@@ -0,0 +1,240 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/singleflight"
+)
+
+func TestCacheFollowerTimeout(t *testing.T) {
+	tests := []struct {
+		policy       FollowerPolicy
+		wantCode     int
+		wantBody     string
+		wantHandlers int32
+	}{
+		{FollowerPolicyBypass, http.StatusOK, "2", 2},
+		{FollowerPolicyFail, http.StatusGatewayTimeout, "", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			var count atomic.Int32
+			started := make(chan struct{})
+			release := make(chan struct{})
+
+			r := gin.New()
+			r.GET("/cache/follower", Cache(newStore(time.Minute), time.Minute, func(c *gin.Context) {
+				n := count.Add(1)
+				if n == 1 {
+					close(started)
+					<-release
+				}
+				c.String(http.StatusOK, fmt.Sprint(n))
+			}, WithFollowerTimeout(20*time.Millisecond, tt.policy)))
+
+			leader := make(chan *httptest.ResponseRecorder)
+			go func() { leader <- performRequest("/cache/follower", r) }()
+			<-started
+
+			w := performRequest("/cache/follower", r)
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			assert.Equal(t, tt.wantHandlers, count.Load())
+
+			// the leader is never timed out.
+			close(release)
+			w = <-leader
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "1", w.Body.String())
+		})
+	}
+}
+
+func TestCacheSingleflightPanic(t *testing.T) {
+	for _, timeout := range []time.Duration{0, 5 * time.Second} {
+		t.Run(fmt.Sprint(timeout), func(t *testing.T) {
+			started := make(chan struct{})
+			release := make(chan struct{})
+			var once sync.Once
+			var mu sync.Mutex
+			var panics []any
+
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				defer func() {
+					if v := recover(); v != nil {
+						mu.Lock()
+						panics = append(panics, v)
+						mu.Unlock()
+						c.AbortWithStatus(http.StatusInternalServerError)
+					}
+				}()
+				c.Next()
+			})
+			r.GET("/cache/panic", Cache(newStore(time.Minute), time.Minute, func(c *gin.Context) {
+				once.Do(func() { close(started) })
+				<-release
+				panic("handler failed")
+			}, WithFollowerTimeout(timeout, FollowerPolicyBypass)))
+
+			const requests = 3
+			codes := make(chan int, requests)
+			go func() { codes <- performRequest("/cache/panic", r).Code }()
+			<-started
+			for i := 1; i < requests; i++ {
+				go func() { codes <- performRequest("/cache/panic", r).Code }()
+			}
+			// the followers join the flight.
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+
+			for i := 0; i < requests; i++ {
+				select {
+				case code := <-codes:
+					assert.Equal(t, http.StatusInternalServerError, code)
+				case <-time.After(5 * time.Second):
+					t.Fatal("the request is blocked by the panic of the leader")
+				}
+			}
+			require.Len(t, panics, requests)
+			for _, v := range panics {
+				var panicErr *PanicError
+				require.True(t, errors.As(v.(error), &panicErr))
+				assert.Equal(t, "handler failed", panicErr.Value)
+				assert.NotEmpty(t, panicErr.Stack)
+			}
+		})
+	}
+}
+
+func TestCacheSingleflightAbortHandler(t *testing.T) {
+	var got any
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		defer func() {
+			got = recover()
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}()
+		c.Next()
+	})
+	r.GET("/cache/abort", Cache(newStore(time.Minute), time.Minute, func(c *gin.Context) {
+		panic(http.ErrAbortHandler)
+	}, WithFollowerTimeout(time.Second, FollowerPolicyBypass)))
+
+	performRequest("/cache/abort", r)
+	assert.Equal(t, http.ErrAbortHandler, got)
+}
+
+func TestCacheSingleflightFollowersOfAbortedLeader(t *testing.T) {
+	tests := []struct {
+		policy       FollowerPolicy
+		wantCode     int
+		wantHandlers int32
+	}{
+		{FollowerPolicyBypass, http.StatusOK, 3},
+		{FollowerPolicyFail, http.StatusGatewayTimeout, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			var count atomic.Int32
+			started := make(chan struct{})
+			release := make(chan struct{})
+			var mu sync.Mutex
+			var panics []any
+
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				defer func() {
+					if v := recover(); v != nil {
+						mu.Lock()
+						panics = append(panics, v)
+						mu.Unlock()
+						c.AbortWithStatus(http.StatusInternalServerError)
+					}
+				}()
+				c.Next()
+			})
+			r.GET("/cache/abort", Cache(newStore(time.Minute), time.Minute, func(c *gin.Context) {
+				if count.Add(1) == 1 {
+					close(started)
+					<-release
+					// the client of the leader has gone.
+					panic(http.ErrAbortHandler)
+				}
+				c.String(http.StatusOK, "pong")
+			}, WithFollowerTimeout(5*time.Second, tt.policy)))
+
+			leader := make(chan int)
+			go func() { leader <- performRequest("/cache/abort", r).Code }()
+			<-started
+			const followers = 2
+			codes := make(chan int, followers)
+			for i := 0; i < followers; i++ {
+				go func() { codes <- performRequest("/cache/abort", r).Code }()
+			}
+			// the followers join the flight.
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+
+			assert.Equal(t, http.StatusInternalServerError, <-leader)
+			for i := 0; i < followers; i++ {
+				assert.Equal(t, tt.wantCode, <-codes)
+			}
+			assert.Equal(t, tt.wantHandlers, count.Load())
+			require.Equal(t, []any{http.ErrAbortHandler}, panics)
+		})
+	}
+}
+
+func TestCacheSingleflightAbandonedLeader(t *testing.T) {
+	group := new(singleflight.Group)
+	release := make(chan struct{})
+	// the flight of a leader which has timed out before its call starts.
+	key := GenerateKeyWithPrefix(PageCachePrefix, "%2Fcache%2Fabandoned")
+	group.DoChan(key, func() (any, error) {
+		<-release
+		return nil, errLeaderAbandoned
+	})
+
+	var count atomic.Int32
+	r := gin.New()
+	r.GET("/cache/abandoned", Cache(newStore(time.Minute), time.Minute, func(c *gin.Context) {
+		count.Add(1)
+		// the other follower joins the new flight.
+		time.Sleep(20 * time.Millisecond)
+		c.String(http.StatusOK, "pong")
+	}, WithSingleflight(group), WithFollowerTimeout(5*time.Second, FollowerPolicyFail)))
+
+	const followers = 2
+	responses := make(chan *httptest.ResponseRecorder, followers)
+	for i := 0; i < followers; i++ {
+		go func() { responses <- performRequest("/cache/abandoned", r) }()
+	}
+	// the followers join the flight.
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < followers; i++ {
+		w := <-responses
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "pong", w.Body.String())
+	}
+	assert.Equal(t, int32(1), count.Load())
+}
+
+func TestPanicError(t *testing.T) {
+	err := &PanicError{Value: http.ErrAbortHandler, Stack: []byte("stack")}
+	assert.ErrorIs(t, err, http.ErrAbortHandler)
+	assert.Contains(t, err.Error(), "stack")
+	assert.Nil(t, (&PanicError{Value: "v"}).Unwrap())
+}
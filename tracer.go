@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"context"
+)
+
+// SpanOp the cache operation a span is traced around.
+type SpanOp string
+
+// Traced cache operations.
+const (
+	// SpanGenerateKey around the generate key function.
+	SpanGenerateKey SpanOp = "gincache.generate_key"
+	// SpanStoreGet around persist.Store.Get, decoding included.
+	SpanStoreGet SpanOp = "gincache.store.get"
+	// SpanLock around acquiring the distributed lock, waiting for the lock holder included,
+	// Hit reports the response is stored by the lock holder while waiting.
+	SpanLock SpanOp = "gincache.lock"
+	// SpanHandler around the handler run inside the single flight.
+	SpanHandler SpanOp = "gincache.handler"
+	// SpanEncode around Encoding.Marshal.
+	SpanEncode SpanOp = "gincache.encode"
+	// SpanDecode around Encoding.Unmarshal.
+	SpanDecode SpanOp = "gincache.decode"
+	// SpanStoreSet around persist.Store.Set, encoding included.
+	SpanStoreSet SpanOp = "gincache.store.set"
+)
+
+// SpanInfo attributes of the span, reported when the span ends.
+type SpanInfo struct {
+	// Key the cache key, empty if generate key reports no need to cache.
+	Key string
+	// Hit the store holds the key, only meaningful for SpanStoreGet.
+	Hit bool
+	// Size byte size, the body size for store and handler spans,
+	// the encoded size for encode and decode spans.
+	Size int
+	// Err the operation error, if any.
+	Err error
+}
+
+// Tracer traces the cache operations.
+// Start is called with the request context, c.Request.Context(), and the returned context
+// is passed to End of the same span, so the span can be carried in the context.
+// During SpanHandler the handler sees the returned context as c.Request.Context().
+type Tracer interface {
+	Start(ctx context.Context, op SpanOp) context.Context
+	End(ctx context.Context, op SpanOp, info SpanInfo)
+}
+
+// WithTracer custom tracer, default is nil which traces nothing.
+func WithTracer(t Tracer) Option {
+	return func(c *Config) {
+		if t != nil {
+			c.tracer = t
+		}
+	}
+}
+
+func nopSpanEnd(SpanInfo) {}
+
+// startSpan start a span if tracer is set, the returned function ends the span.
+func (cfg *Config) startSpan(ctx context.Context, op SpanOp) (context.Context, func(SpanInfo)) {
+	if cfg.tracer == nil {
+		return ctx, nopSpanEnd
+	}
+	ctx = cfg.tracer.Start(ctx, op)
+	return ctx, func(info SpanInfo) { cfg.tracer.End(ctx, op, info) }
+}
+
+// encoding returns the Encoding used by request, which is traced if tracer is set.
+func (cfg *Config) encoding(ctx context.Context, key string) Encoding {
+	if cfg.tracer == nil {
+		return cfg.encode
+	}
+	return &tracedEncoding{cfg.encode, cfg.tracer, ctx, key}
+}
+
+type tracedEncoding struct {
+	Encoding
+	tracer Tracer
+	ctx    context.Context
+	key    string
+}
+
+func (te *tracedEncoding) Marshal(v any) ([]byte, error) {
+	ctx := te.tracer.Start(te.ctx, SpanEncode)
+	data, err := te.Encoding.Marshal(v)
+	te.tracer.End(ctx, SpanEncode, SpanInfo{Key: te.key, Size: len(data), Err: err})
+	return data, err
+}
+
+func (te *tracedEncoding) Unmarshal(data []byte, v any) error {
+	ctx := te.tracer.Start(te.ctx, SpanDecode)
+	err := te.Encoding.Unmarshal(data, v)
+	te.tracer.End(ctx, SpanDecode, SpanInfo{Key: te.key, Size: len(data), Err: err})
+	return err
+}
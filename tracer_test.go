@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type spanCtxKey struct{}
+
+type recordTracer struct {
+	started []SpanOp
+	ended   []SpanInfo
+}
+
+func (rt *recordTracer) Start(ctx context.Context, op SpanOp) context.Context {
+	rt.started = append(rt.started, op)
+	return context.WithValue(ctx, spanCtxKey{}, op)
+}
+
+func (rt *recordTracer) End(ctx context.Context, op SpanOp, info SpanInfo) {
+	if ctx.Value(spanCtxKey{}) != op {
+		panic("span context mismatch")
+	}
+	rt.ended = append(rt.ended, info)
+}
+
+func TestCacheTracer(t *testing.T) {
+	tracer := &recordTracer{}
+
+	var handlerSpan any
+	r := gin.New()
+	r.GET("/cache/trace", Cache(newBinaryStore(), time.Second*3, func(c *gin.Context) {
+		handlerSpan = c.Request.Context().Value(spanCtxKey{})
+		c.String(http.StatusOK, "pong")
+	}, WithTracer(tracer)))
+
+	w1 := performRequest("/cache/trace", r)
+	require.Equal(t, SpanHandler, handlerSpan)
+	assert.Equal(t, []SpanOp{
+		SpanGenerateKey,
+		SpanStoreGet,
+		SpanHandler,
+		SpanStoreSet,
+		SpanEncode,
+	}, tracer.started)
+	require.Len(t, tracer.ended, 5)
+	key := tracer.ended[0].Key
+	assert.NotEmpty(t, key)
+	assert.Equal(t, SpanInfo{Key: key}, tracer.ended[1])
+	assert.Equal(t, SpanInfo{Key: key, Size: 4}, tracer.ended[2])
+	assert.Equal(t, key, tracer.ended[3].Key)
+	assert.Greater(t, tracer.ended[3].Size, 4)
+	assert.Equal(t, SpanInfo{Key: key, Size: 4}, tracer.ended[4])
+
+	tracer.started, tracer.ended = nil, nil
+	w2 := performRequest("/cache/trace", r)
+	assert.Equal(t, []SpanOp{SpanGenerateKey, SpanStoreGet, SpanDecode}, tracer.started)
+	require.Len(t, tracer.ended, 3)
+	assert.Greater(t, tracer.ended[1].Size, 4)
+	assert.Equal(t, SpanInfo{Key: key, Hit: true, Size: 4}, tracer.ended[2])
+
+	assert.Equal(t, w1.Body.String(), w2.Body.String())
+}